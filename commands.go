@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"RacoBot/internal/db"
+)
+
+// runCommand runs the given subcommand with the given arguments, it returns false if there's no subcommand
+func runCommand(command string, args []string) bool {
+	switch command {
+	case "":
+		return false
+	case "backup":
+		backup(args)
+	case "restore":
+		restore(args)
+	case "reencrypt":
+		reencrypt()
+	default:
+		log.Fatalf("unknown command %q, available ones are `backup [file]`, `restore [file]` and `reencrypt`", command)
+	}
+	return true
+}
+
+// loadArchiveKey loads the key for encrypting backup archives from the file in the `-archive-key-file` flag,
+// which holds a base64-encoded 32-byte key, nil if the flag is not set
+func loadArchiveKey() []byte {
+	if archiveKeyFile == "" {
+		return nil
+	}
+	f, err := os.ReadFile(archiveKeyFile)
+	if err != nil {
+		log.Fatalf("failed to read archive key file: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(f)))
+	if err != nil {
+		log.Fatalf("failed to decode archive key: %v", err)
+	}
+	return key
+}
+
+// backup writes a backup archive of the bot's data to the file in the given arguments, or to stdout if not given
+// on command `backup [file]`
+func backup(args []string) {
+	key := loadArchiveKey()
+	if key == nil {
+		log.Warn("no archive key file given, the archive (including users' OAuth tokens) is not encrypted")
+	}
+
+	if len(args) == 0 || args[0] == "-" {
+		count, err := db.Backup(os.Stdout, key)
+		if err != nil {
+			log.Fatalf("failed to back up: %v", err)
+		}
+		log.Infof("backed up %d users", count)
+		return
+	}
+
+	// written to a temporary file first, which is renamed to the given one once complete,
+	// so a failed backup never leaves a partial archive behind
+	path := args[0]
+	if _, err := os.Lstat(path); err == nil {
+		log.Fatalf("failed to create archive file: %s already exists", path)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		log.Fatalf("failed to create archive file: %v", err)
+	}
+	count, err := db.Backup(f, key)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		log.Fatalf("failed to back up: %v", err)
+	}
+	log.Infof("backed up %d users", count)
+}
+
+// restore imports a backup archive from the file in the given arguments, or from stdin if not given,
+// users already in DB are merged instead of being overwritten
+// on command `restore [file]`
+func restore(args []string) {
+	var r io.Reader = os.Stdin
+	if len(args) > 0 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			log.Fatalf("failed to open archive file: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	added, merged, err := db.Restore(r, loadArchiveKey())
+	if err != nil {
+		log.Fatalf("failed to restore: %v", err)
+	}
+	log.Infof("restored %d new users and merged %d existing ones", added, merged)
+}
+
+// reencrypt encrypts all users' OAuth tokens with the current encryption key,
+// those on other keys included, so any key other than the current one can be retired afterwards
+// on command `reencrypt`
+func reencrypt() {
+	count, err := db.ReencryptTokens()
+	if err != nil {
+		log.Fatalf("failed to re-encrypt OAuth tokens: %v", err)
+	}
+	log.Infof("re-encrypted OAuth tokens of %d users", count)
+}
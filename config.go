@@ -19,18 +19,20 @@ import (
 
 // Config represents a complete configuration
 type Config struct {
-	Host        string        `toml:"host,omitempty"`
-	Port        uint16        `toml:"port,omitempty"`
-	Log         LogConfig     `toml:"log,omitempty"`
-	TLS         TLSConfig     `toml:"tls,omitempty"`
-	Redis       db.Config     `toml:"redis"`
-	TelegramBot bot.Config    `toml:"telegram_bot"`
-	FIBAPI      fibapi.Config `toml:"fib_api"`
-	JobsConfig  job.Config    `toml:"jobs,omitempty"`
+	Host        string         `toml:"host,omitempty"`
+	Port        uint16         `toml:"port,omitempty"`
+	Log         LogConfig      `toml:"log,omitempty"`
+	TLS         TLSConfig      `toml:"tls,omitempty"`
+	Store       db.StoreConfig `toml:"store,omitempty"`
+	Redis       db.Config      `toml:"redis"`
+	TelegramBot bot.Config     `toml:"telegram_bot"`
+	FIBAPI      fibapi.Config  `toml:"fib_api"`
+	JobsConfig  job.Config     `toml:"jobs,omitempty"`
 
 	TelegramBotWebhookPath  string
 	FIBAPIOAuthRedirectPath string
 	MailtoLinkRedirectPath  string
+	CalendarFeedPath        string
 }
 
 // LogConfig represents a configuration for the global logger
@@ -155,5 +157,21 @@ func (c *Config) setupRoutingPaths() error {
 	if u.Host == u2.Host { // same host, enable handling mailto link redirects on this server
 		c.MailtoLinkRedirectPath = u2.Path
 	}
+
+	if c.TelegramBot.CalendarFeedURL == "" {
+		c.TelegramBot.CalendarFeedURL = fmt.Sprintf("%s://%s/calendar", u.Scheme, u.Host)
+	}
+	u3, err := url.Parse(c.TelegramBot.CalendarFeedURL)
+	if err != nil {
+		return fmt.Errorf("invalid calendar feed URL: %w", err)
+	}
+	if u3.RawQuery != "" {
+		c.TelegramBot.CalendarFeedURL += "&"
+	} else {
+		c.TelegramBot.CalendarFeedURL += "?"
+	}
+	if u.Host == u3.Host { // same host, enable serving calendar feeds on this server
+		c.CalendarFeedPath = u3.Path
+	}
 	return nil
 }
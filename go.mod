@@ -10,6 +10,7 @@ require (
 	github.com/pelletier/go-toml/v2 v2.2.1
 	github.com/redis/go-redis/v9 v9.5.1
 	github.com/sirupsen/logrus v1.9.3
+	go.etcd.io/bbolt v1.3.9
 	golang.org/x/oauth2 v0.19.0
 	gopkg.in/telebot.v3 v3.2.1
 )
@@ -20,5 +21,5 @@ require (
 	github.com/google/uuid v1.4.0 // indirect
 	github.com/robfig/cron/v3 v3.0.1 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 )
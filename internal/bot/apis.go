@@ -1,8 +1,13 @@
 package bot
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,6 +22,9 @@ import (
 type Client struct {
 	fibapi.PrivateClient
 	db.User
+	ctx context.Context // of all FIB API requests made by the client
+
+	noticesValidators db.NoticesValidators // of the notices fetched by GetNewNotices, see SaveNoticesValidators
 }
 
 // errors
@@ -28,7 +36,13 @@ var (
 // NewClient initializes a FIB API private client with the given Telegram userID
 // if that userID doesn't exist in the database, it will return nil and leave it for the later API caller to handle
 // thus simplifies its usage to: `xxx, err := NewClient(userID).GetXXX()`
+// its requests are cancelled when the bot stops
 func NewClient(userID int64) *Client {
+	return NewClientContext(ctx, userID)
+}
+
+// NewClientContext is like NewClient but its requests (including the refreshes of its token) are made with the given context
+func NewClientContext(ctx context.Context, userID int64) *Client {
 	user, err := db.GetUser(userID)
 	if err != nil {
 		if !errors.Is(err, db.ErrUserNotFound) {
@@ -36,13 +50,20 @@ func NewClient(userID int64) *Client {
 		}
 		return nil
 	}
+	return NewClientFromUser(ctx, user)
+}
+
+// NewClientFromUser is like NewClientContext but with the given user already got from the database,
+// it returns nil if the user has no token
+func NewClientFromUser(ctx context.Context, user db.User) *Client {
 	if user.AccessToken == "" || user.RefreshToken == "" {
 		return nil
 	}
 
 	return &Client{
-		*fibapi.NewClient(user.AccessToken, user.RefreshToken, user.TokenExpiry),
-		user,
+		PrivateClient: *fibapi.NewClientContext(ctx, user.AccessToken, user.RefreshToken, user.TokenExpiry),
+		User:          user,
+		ctx:           ctx,
 	}
 }
 
@@ -83,7 +104,7 @@ func (c *Client) GetFullName() (string, error) {
 	}
 	defer c.updateToken()
 
-	userInfo, err := c.PrivateClient.GetUserInfo()
+	userInfo, err := c.PrivateClient.GetUserInfoContext(c.ctx)
 	if err != nil {
 		return "", err
 	}
@@ -97,14 +118,14 @@ func (c *Client) GetNotices() ([]NoticeMessage, error) {
 	}
 	defer c.updateToken()
 
-	notices, err := c.PrivateClient.GetNotices()
+	notices, err := c.PrivateClient.GetNoticesContext(c.ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	msgs := make([]NoticeMessage, 0, len(notices))
 	for _, notice := range notices {
-		msgs = append(msgs, NoticeMessage{notice, c.User, getNoticeLinkURL(notice)})
+		msgs = append(msgs, NoticeMessage{Notice: notice, User: c.User, linkURL: getNoticeLinkURL(c.ctx, notice)})
 	}
 	return msgs, nil
 }
@@ -116,43 +137,373 @@ func (c *Client) GetNotice(ID int32) (NoticeMessage, error) {
 	}
 	defer c.updateToken()
 
-	notice, err := c.PrivateClient.GetNotice(ID)
+	notice, err := c.PrivateClient.GetNoticeContext(c.ctx, ID)
 	if err != nil {
 		return NoticeMessage{}, err
 	}
-	return NoticeMessage{notice, c.User, getNoticeLinkURL(notice)}, nil
+	return NoticeMessage{Notice: notice, User: c.User, linkURL: getNoticeLinkURL(c.ctx, notice)}, nil
 }
 
-// GetNewNotices gets the user's new notice messages
+// GetNewNotices gets the user's new notice messages, i.e., the ones which haven't been seen by the user,
+// or have been re-published (modified) since seen
+// the seen notices which have expired and are gone are forgotten
+// the notices are fetched only if they have changed since the last time their validators were saved,
+// see SaveNoticesValidators
 func (c *Client) GetNewNotices() ([]NoticeMessage, error) {
 	if c == nil {
 		return nil, ErrUserNotFound
 	}
 	defer c.updateToken()
 
-	ns, err := c.PrivateClient.GetNoticesSince(c.User.LastNoticeTimestamp)
+	validators, err := db.GetNoticesValidators(c.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	c.noticesValidators = validators
+	ns, v, err := c.PrivateClient.GetNoticesSinceIfModifiedContext(c.ctx, 0, fibapi.Validators(validators))
+	if err != nil {
+		if errors.Is(err, fibapi.ErrNotModified) { // nothing has changed since
+			return nil, nil
+		}
+		return nil, err
+	}
+	c.noticesValidators = db.NoticesValidators(v)
+	seen, err := db.GetDeliveredNotices(c.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !c.User.SeenNoticesSeeded {
+		if ns, err = c.seedSeenNotices(ns); err != nil {
+			return nil, err
+		}
+	}
+
+	msgs := make([]NoticeMessage, 0, len(ns))
+	current := make(map[int32]bool, len(ns))
+	for _, n := range ns {
+		current[n.ID] = true
+		if s, ok := seen[n.ID]; ok && s.Version >= n.PublishedAt.Unix() {
+			continue
+		}
+		msgs = append(msgs, NoticeMessage{Notice: n, User: c.User, linkURL: getNoticeLinkURL(c.ctx, n)})
+	}
+
+	now := time.Now().Unix()
+	var goneIDs []int32
+	for ID, s := range seen {
+		if !current[ID] && s.ExpiresAt < now {
+			goneIDs = append(goneIDs, ID)
+		}
+	}
+	if err = db.DelDeliveredNotices(c.User.ID, goneIDs...); err != nil {
+		log.Errorf("failed to delete gone delivered notices of user %d: %v", c.User.ID, err)
+	}
+	return msgs, nil
+}
+
+// SaveNoticesValidators saves the validators of the notices fetched by the last GetNewNotices call,
+// it should be called once all the new notices have been handled, otherwise they wouldn't be fetched again
+// until the notices change
+func (c *Client) SaveNoticesValidators() error {
+	return db.PutNoticesValidators(c.User.ID, c.noticesValidators)
+}
+
+// seedSeenNotices marks the given notices as seen for a user whose seen notices haven't been tracked yet,
+// i.e., all of them for a new user, or the ones published until the last notice timestamp for a user from before
+// it returns the rest of the notices, which should be treated as new
+func (c *Client) seedSeenNotices(ns []fibapi.Notice) ([]fibapi.Notice, error) {
+	seen := make(map[int32]db.DeliveredNotice, len(ns))
+	rest := make([]fibapi.Notice, 0)
+	for _, n := range ns {
+		if c.User.LastNoticeTimestamp != 0 && n.PublishedAt.Unix() > c.User.LastNoticeTimestamp {
+			rest = append(rest, n)
+			continue
+		}
+		seen[n.ID] = db.DeliveredNotice{Version: n.PublishedAt.Unix(), ExpiresAt: n.ExpiresAt.Unix()}
+	}
+	if err := db.PutDeliveredNotices(c.User.ID, seen); err != nil {
+		return nil, err
+	}
+
+	c.User.SeenNoticesSeeded = true
+	c.User.LastNoticeTimestamp = 0
+	if err := db.PutUser(c.User); err != nil {
+		return nil, err
+	}
+	return rest, nil
+}
+
+// EnqueueNotice queues the given notice message to be delivered to its user, fenced by the client's context
+// it returns false if the same version of the notice is already queued
+func (c *Client) EnqueueNotice(m NoticeMessage) (bool, error) {
+	notice, err := json.Marshal(m.Notice)
+	if err != nil {
+		return false, err
+	}
+	return db.EnqueueOutboundNotice(db.NewOutboundNotice(m.User.ID, m.ID, m.PublishedAt.Unix(), notice), db.FenceFromContext(c.ctx))
+}
+
+// NewOutboundNoticeMessage makes a NoticeMessage of the given outbound notice to the given user
+func NewOutboundNoticeMessage(o db.OutboundNotice, user db.User) (NoticeMessage, error) {
+	var n fibapi.Notice
+	if err := json.Unmarshal(o.Notice, &n); err != nil {
+		return NoticeMessage{}, err
+	}
+	return NoticeMessage{Notice: n, User: user, linkURL: getNoticeLinkURL(ctx, n)}, nil
+}
+
+// GetSchedule gets the user's weekly class schedule
+func (c *Client) GetSchedule() ([]fibapi.Class, error) {
+	if c == nil {
+		return nil, ErrUserNotFound
+	}
+	defer c.updateToken()
+
+	return c.PrivateClient.GetScheduleContext(c.ctx)
+}
+
+// ScheduleClassReminders schedules reminders for the user's classes on the given date,
+// each of them is due the user's preferred minutes before the class starts
+// it returns the number of scheduled reminders, classes that have already started or are too close to start are skipped
+func (c *Client) ScheduleClassReminders(date time.Time) (int, error) {
+	if c == nil {
+		return 0, ErrUserNotFound
+	}
+	if c.User.ClassReminderMinutes == 0 { // disabled
+		return 0, nil
+	}
+
+	classes, err := c.GetSchedule()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	advance := time.Duration(c.User.ClassReminderMinutes) * time.Minute
+	count := 0
+	for _, class := range classes {
+		if class.Weekday() != date.Weekday() {
+			continue
+		}
+		start, err := class.Start(date)
+		if err != nil {
+			log.Errorf("failed to get start time of class %s of user %d: %v", class.SubjectCode, c.User.ID, err)
+			continue
+		}
+		dueAt := start.Add(-advance)
+		if dueAt.Before(now) {
+			continue
+		}
+
+		r := db.Reminder{
+			ID:          fmt.Sprintf("c:%d:%s:%s:%d", c.User.ID, class.SubjectCode, class.Group, start.Unix()),
+			UserID:      c.User.ID,
+			Type:        db.ClassReminder,
+			SubjectCode: class.SubjectCode,
+			Group:       class.Group,
+			Types:       class.Types,
+			Classrooms:  class.Classrooms,
+			StartsAt:    start.Unix(),
+		}
+		if err = db.PutReminder(r, dueAt, db.FenceFromContext(c.ctx)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// GetSubjects gets the user's subjects
+func (c *Client) GetSubjects() ([]fibapi.Subject, error) {
+	if c == nil {
+		return nil, ErrUserNotFound
+	}
+	defer c.updateToken()
+
+	return c.PrivateClient.GetSubjectsContext(c.ctx)
+}
+
+// PruneSubjectSettings removes the user's per-subject settings of the subjects they are no longer enrolled in,
+// the user is put to the database only if anything has been removed
+func (c *Client) PruneSubjectSettings(subjects []fibapi.Subject) error {
+	if c == nil {
+		return ErrUserNotFound
+	}
+
+	enrolled := make(map[string]struct{}, len(subjects))
+	for _, s := range subjects {
+		enrolled[s.ID] = struct{}{}
+	}
+
+	pruned := false
+	for code := range c.User.SubjectNoticeModes {
+		if _, ok := enrolled[code]; !ok {
+			delete(c.User.SubjectNoticeModes, code)
+			pruned = true
+		}
+	}
+	mutedExamSubjects := slices.DeleteFunc(slices.Clone(c.User.MutedExamSubjects), func(code string) bool {
+		_, ok := enrolled[code]
+		return !ok
+	})
+	if len(mutedExamSubjects) != len(c.User.MutedExamSubjects) {
+		c.User.MutedExamSubjects = mutedExamSubjects
+		pruned = true
+	}
+
+	if !pruned {
+		return nil
+	}
+	return db.PutUser(c.User)
+}
+
+// GetExams gets the user's upcoming exams, i.e., the exams of their subjects which haven't started yet
+func (c *Client) GetExams() ([]fibapi.Exam, error) {
+	if c == nil {
+		return nil, ErrUserNotFound
+	}
+	defer c.updateToken()
+
+	subjects, err := c.PrivateClient.GetSubjectsContext(c.ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { // save the last notice's timestamp to DB
-		if len(ns) > 0 {
-			c.User.LastNoticeTimestamp = ns[len(ns)-1].PublishedAt.Unix()
-			if e := db.PutUser(c.User); e != nil {
-				log.Errorf("failed to put user %d: %v", c.User.ID, e)
+	exams, err := fibapi.GetPublicExamsContext(c.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return FilterUpcomingExams(exams, subjects, time.Now()), nil
+}
+
+// FilterUpcomingExams filters the given exams to the ones of the given subjects that start after the given time,
+// sorted by their start time
+func FilterUpcomingExams(exams []fibapi.Exam, subjects []fibapi.Subject, now time.Time) []fibapi.Exam {
+	subjectIDs := make(map[string]struct{}, len(subjects))
+	for _, s := range subjects {
+		subjectIDs[s.ID] = struct{}{}
+	}
+
+	upcoming := make([]fibapi.Exam, 0)
+	for _, e := range exams {
+		if _, ok := subjectIDs[e.SubjectCode]; ok && e.StartsAt.After(now) {
+			upcoming = append(upcoming, e)
+		}
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		// sort orders: StartsAt, SubjectCode
+		if upcoming[i].StartsAt.Equal(upcoming[j].StartsAt.Time) {
+			return upcoming[i].SubjectCode < upcoming[j].SubjectCode
+		}
+		return upcoming[i].StartsAt.Before(upcoming[j].StartsAt.Time)
+	})
+	return upcoming
+}
+
+// SyncExamReminders schedules reminders of the given upcoming exams of the user, each due at the given offsets before
+// the exam starts, exams of the subjects the user has muted are skipped
+// it returns the exams whose time or classrooms have changed since the last sync, their reminders are rescheduled
+func (c *Client) SyncExamReminders(upcoming []fibapi.Exam, offsets []time.Duration) ([]fibapi.Exam, error) {
+	if c == nil {
+		return nil, ErrUserNotFound
+	}
+
+	known, err := db.GetKnownExams(c.User.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get known exams: %w", err)
+	}
+
+	now := time.Now()
+	reminders := make([]int64, 0, len(offsets))
+	for _, offset := range offsets {
+		reminders = append(reminders, int64(offset.Seconds()))
+	}
+	current := make(map[int32]db.KnownExam, len(upcoming))
+	var changed []fibapi.Exam
+	for _, e := range upcoming {
+		if slices.Contains(c.User.MutedExamSubjects, e.SubjectCode) {
+			continue
+		}
+		state := db.KnownExam{
+			StartsAt:   e.StartsAt.Unix(),
+			EndsAt:     e.EndsAt.Unix(),
+			Classrooms: e.Classrooms,
+			Reminders:  reminders,
+		}
+		current[e.ID] = state
+
+		var scheduled []int64 // offsets of its reminders which are still scheduled as they are
+		if last, ok := known[e.ID]; ok {
+			if last.StartsAt != state.StartsAt || last.EndsAt != state.EndsAt || last.Classrooms != state.Classrooms {
+				changed = append(changed, e)
+				// cancel all its reminders, as the past-due ones of the new time are not put again below
+				c.delExamReminders(e.ID, knownExamReminders(last, reminders))
+			} else {
+				scheduled = knownExamReminders(last, reminders)
+				if slices.Equal(scheduled, reminders) { // nothing changed, its reminders have already been scheduled
+					continue
+				}
+				// the configured offsets have changed, cancel its reminders at the ones no longer configured
+				c.delExamReminders(e.ID, slices.DeleteFunc(slices.Clone(scheduled), func(s int64) bool {
+					return slices.Contains(reminders, s)
+				}))
 			}
 		}
-	}()
 
-	var msgs []NoticeMessage
-	if c.User.LastNoticeTimestamp != 0 { // if not a new user, send the new notices
-		msgs = make([]NoticeMessage, 0, len(ns))
-		for _, n := range ns {
-			if n.PublishedAt.Unix() > c.User.LastNoticeTimestamp {
-				msgs = append(msgs, NoticeMessage{n, c.User, getNoticeLinkURL(n)})
+		for i, offset := range offsets {
+			dueAt := e.StartsAt.Add(-offset)
+			if dueAt.Before(now) || slices.Contains(scheduled, reminders[i]) {
+				continue
+			}
+			r := db.Reminder{
+				ID:          examReminderID(c.User.ID, e.ID, offset),
+				UserID:      c.User.ID,
+				Type:        db.ExamReminder,
+				SubjectCode: e.SubjectCode,
+				Types:       e.Type,
+				Classrooms:  e.Classrooms,
+				StartsAt:    e.StartsAt.Unix(),
+			}
+			if err = db.PutReminder(r, dueAt, db.FenceFromContext(c.ctx)); err != nil {
+				return changed, fmt.Errorf("failed to put reminder %s: %w", r.ID, err)
 			}
 		}
 	}
-	return msgs, nil
+
+	// cancel the reminders of exams that have been removed, have passed, or whose subjects have been muted
+	for ID, last := range known {
+		if _, ok := current[ID]; ok {
+			continue
+		}
+		c.delExamReminders(ID, knownExamReminders(last, reminders))
+	}
+
+	if err = db.PutKnownExams(c.User.ID, current); err != nil {
+		return changed, fmt.Errorf("failed to put known exams: %w", err)
+	}
+	return changed, nil
+}
+
+// examReminderID returns the ID of the reminder of an exam at the given offset before it starts
+func examReminderID(userID int64, examID int32, offset time.Duration) string {
+	return fmt.Sprintf("e:%d:%d:%d", userID, examID, int64(offset.Seconds()))
+}
+
+// knownExamReminders returns the offsets (in seconds) the reminders of the given known exam have been scheduled at,
+// the given current ones if it was known before they were tracked
+func knownExamReminders(e db.KnownExam, current []int64) []int64 {
+	if e.Reminders == nil {
+		return current
+	}
+	return e.Reminders
+}
+
+// delExamReminders cancels the reminders of the user's exam with the given ID at the given offsets (in seconds)
+func (c *Client) delExamReminders(examID int32, offsets []int64) {
+	for _, offset := range offsets {
+		if err := db.DelReminder(examReminderID(c.User.ID, examID, time.Duration(offset)*time.Second)); err != nil {
+			log.Errorf("failed to delete reminder of exam %d of user %d: %v", examID, c.User.ID, err)
+		}
+	}
 }
 
 // Logout revokes the user's OAuth token and deletes it from the database
@@ -166,13 +517,13 @@ func (c *Client) Logout() error {
 			log.Errorf("failed to delete user %d: %v", c.User.ID, e)
 		}
 	}()
-	if err := c.PrivateClient.RevokeToken(); err != nil {
+	if err := c.PrivateClient.RevokeTokenContext(c.ctx); err != nil {
 		return fmt.Errorf("failed to revoke token: %w", err)
 	}
 	return nil
 }
 
-func getNoticeLinkURL(n fibapi.Notice) string {
+func getNoticeLinkURL(ctx context.Context, n fibapi.Notice) string {
 	if strings.HasPrefix(n.SubjectCode, "#") {
 		// special banner notice, not viewable on /avisos/veure.jsp
 		return fmt.Sprintf("%s/#avis-%d", racoBaseURL, n.ID)
@@ -182,7 +533,7 @@ func getNoticeLinkURL(n fibapi.Notice) string {
 	if err != nil {
 		if err == db.ErrSubjectNotFound {
 			// not found in DB, try to get the code from FIB API
-			subject, e := fibapi.GetPublicSubject(n.SubjectCode)
+			subject, e := fibapi.GetPublicSubjectContext(ctx, n.SubjectCode)
 			if e != nil {
 				log.Errorf("failed to get UPC code of %s from API: %v", n.SubjectCode, e)
 				return racoBaseURL
@@ -201,3 +552,33 @@ func getNoticeLinkURL(n fibapi.Notice) string {
 	}
 	return fmt.Sprintf(racoNoticeURLTemplate, code, n.ID)
 }
+
+// metaFIBAPIDownSince is the name of the metadata of when FIB API went down (UNIX timestamp) as last announced to the admins
+// by the leader instance, "0" if it was last announced to be up, and empty if it has never been announced
+const metaFIBAPIDownSince = "fibapi_down_since"
+
+// GetAnnouncedFIBAPIStatus gets the status of FIB API as last announced to the admins by the leader instance,
+// which makes most of the requests, false if it has never been announced
+func GetAnnouncedFIBAPIStatus() (fibapi.BreakerStatus, bool, error) {
+	value, err := db.GetMeta(metaFIBAPIDownSince)
+	if err != nil || value == "" {
+		return fibapi.BreakerStatus{}, false, err
+	}
+	since, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fibapi.BreakerStatus{}, false, err
+	}
+	if since == 0 {
+		return fibapi.BreakerStatus{State: fibapi.BreakerClosed}, true, nil
+	}
+	return fibapi.BreakerStatus{State: fibapi.BreakerOpen, Since: time.Unix(since, 0)}, true, nil
+}
+
+// PutAnnouncedFIBAPIStatus puts the given status of FIB API as announced to the admins, see GetAnnouncedFIBAPIStatus
+func PutAnnouncedFIBAPIStatus(status fibapi.BreakerStatus) error {
+	var since int64
+	if status.State != fibapi.BreakerClosed {
+		since = status.Since.Unix()
+	}
+	return db.PutMeta(metaFIBAPIDownSince, strconv.FormatInt(since, 10))
+}
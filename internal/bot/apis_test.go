@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"RacoBot/internal/db"
+	"RacoBot/pkg/fibapi"
+)
+
+func TestSyncExamReminders(t *testing.T) {
+	defer db.Close()
+	reset := func() {
+		db.Close()
+		db.Init(db.StoreConfig{Backend: db.BackendMemory}, db.Config{})
+	}
+
+	c := &Client{User: db.User{ID: 1}, ctx: context.Background()}
+	now := time.Now()
+	exam := func(startsIn time.Duration, classrooms string) fibapi.Exam {
+		startsAt := now.Add(startsIn).Truncate(time.Second)
+		return fibapi.Exam{ID: 42, SubjectCode: "IES", Classrooms: classrooms,
+			StartsAt: fibapi.Time{Time: startsAt}, EndsAt: fibapi.Time{Time: startsAt.Add(2 * time.Hour)}}
+	}
+	// returns the classrooms of the scheduled reminders by ID
+	scheduled := func() map[string]string {
+		t.Helper()
+		reminders, err := db.PopDueReminders(now.Add(30*24*time.Hour), 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string, len(reminders))
+		for _, r := range reminders {
+			got[r.ID] = r.Classrooms
+		}
+		return got
+	}
+	sync := func(e fibapi.Exam, offsets ...time.Duration) []fibapi.Exam {
+		t.Helper()
+		changed, err := c.SyncExamReminders([]fibapi.Exam{e}, offsets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return changed
+	}
+
+	reset()
+	if changed := sync(exam(72*time.Hour, "A5001"), 48*time.Hour, time.Hour); len(changed) != 0 {
+		t.Errorf("new exam: got changed %v", changed)
+	}
+	if diff := cmp.Diff(map[string]string{"e:1:42:172800": "A5001", "e:1:42:3600": "A5001"}, scheduled()); diff != "" {
+		t.Errorf("new exam: scheduled reminders mismatch (-want +got):\n%s", diff)
+	}
+
+	// moved earlier, so its reminder 2 days before is past-due and must not fire with the old time and classrooms
+	reset()
+	sync(exam(72*time.Hour, "A5001"), 48*time.Hour, time.Hour)
+	if changed := sync(exam(24*time.Hour, "A6001"), 48*time.Hour, time.Hour); len(changed) != 1 {
+		t.Errorf("moved exam: got changed %v", changed)
+	}
+	if diff := cmp.Diff(map[string]string{"e:1:42:3600": "A6001"}, scheduled()); diff != "" {
+		t.Errorf("moved exam: scheduled reminders mismatch (-want +got):\n%s", diff)
+	}
+
+	// an offset is no longer configured
+	reset()
+	sync(exam(72*time.Hour, "A5001"), 48*time.Hour, time.Hour)
+	if changed := sync(exam(72*time.Hour, "A5001"), time.Hour); len(changed) != 0 {
+		t.Errorf("removed offset: got changed %v", changed)
+	}
+	if diff := cmp.Diff(map[string]string{"e:1:42:3600": "A5001"}, scheduled()); diff != "" {
+		t.Errorf("removed offset: scheduled reminders mismatch (-want +got):\n%s", diff)
+	}
+}
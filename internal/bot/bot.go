@@ -1,10 +1,14 @@
 package bot
 
 import (
+	"context"
+	"errors"
 	"reflect"
+	"regexp"
 	"runtime"
 	"slices"
 	"strconv"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	tb "gopkg.in/telebot.v3"
@@ -21,6 +25,10 @@ var (
 	WebhookSecretToken    string
 	Username              string
 	MailtoLinkRedirectURL string
+	CalendarFeedURL       string
+
+	// ctx is the context of FIB API requests made on behalf of the bot's handlers, cancelled when the bot stops
+	ctx, cancelRequests = context.WithCancel(context.Background())
 )
 
 // HandleUpdate handles a Telegram bot update
@@ -35,6 +43,7 @@ type Config struct {
 	WebhookURL            string  `toml:"webhook_url,omitempty"`
 	WebhookSecretToken    string  `toml:"webhook_secret_token,omitempty"`
 	MailtoLinkRedirectURL string  `toml:"mailto_link_redirect_url,omitempty"`
+	CalendarFeedURL       string  `toml:"calendar_feed_url,omitempty"`
 }
 
 var (
@@ -43,6 +52,9 @@ var (
 	setLanguageButtonEN = setLanguageMenu.Data("English", "en")
 	setLanguageButtonES = setLanguageMenu.Data("Castellano", "es")
 	setLanguageButtonCA = setLanguageMenu.Data("Català", "ca")
+
+	// button (with a subject code as data) in the menus for setting per-subject notice modes, for registering its handler
+	noticeModeButton = tb.Btn{Unique: "notice_mode"}
 )
 
 // Init initializes the bot
@@ -65,11 +77,22 @@ func Init(config Config) {
 	b.Handle("/login", login)
 	b.Handle("/lang", setPreferredLanguage)
 	b.Handle("/toggle_mute_banner_notices", toggleMuteBannerNotices)
+	b.Handle("/toggle_daily_schedule", toggleDailySchedule)
+	b.Handle("/class_reminders", setClassReminders)
+	b.Handle("/toggle_exam_reminders", toggleExamReminders)
+	b.Handle("/add_rule", addAlertRule)
+	b.Handle("/rules", listAlertRules)
+	b.Handle("/del_rule", delAlertRule)
+	b.Handle("/calendar", calendar)
 	b.Handle("/whoami", whoami)
+	b.Handle("/schedule", schedule)
+	b.Handle("/exams", exams)
+	b.Handle("/status", status)
 	b.Handle("/test", test)
 	b.Handle("/logout", logout)
 	b.Handle("/debug", debug)
 	b.Handle("/announce", publishAnnouncement, adminOnly)
+	b.Handle("/dead_letters", listDeadLetters, adminOnly)
 
 	// initialize the menu for selecting preferred language
 	setLanguageMenu.Inline(setLanguageMenu.Row(setLanguageButtonCA, setLanguageButtonES, setLanguageButtonEN))
@@ -77,6 +100,9 @@ func Init(config Config) {
 	b.Handle(&setLanguageButtonES, setPreferredLanguage)
 	b.Handle(&setLanguageButtonEN, setPreferredLanguage)
 
+	b.Handle("/notice_settings", noticeSettings)
+	b.Handle(&noticeModeButton, noticeSettings)
+
 	// set command menus
 	for _, languageCode := range locale.LanguageCodes {
 		if err = b.SetCommands(locale.Get(languageCode).CommandsMenu, tb.CommandScopeDefault, languageCode); err != nil {
@@ -111,12 +137,14 @@ func Init(config Config) {
 	adminUIDs = config.AdminUID
 
 	MailtoLinkRedirectURL = config.MailtoLinkRedirectURL
+	CalendarFeedURL = config.CalendarFeedURL
 
 	log.Debug("bot started")
 }
 
 // Stop stops the bot
 func Stop() {
+	cancelRequests()
 	if b != nil {
 		if useLongPoller {
 			b.Stop()
@@ -136,7 +164,7 @@ func errorInterceptor(next tb.HandlerFunc) tb.HandlerFunc {
 			if err == ErrUserNotFound {
 				return c.Send(locale.Get(c.Sender().LanguageCode).StartMessage)
 			}
-			if err == fibapi.ErrAuthorizationExpired {
+			if errors.Is(err, fibapi.ErrAuthorizationExpired) {
 				log.Infof("user %d authorization has expired", c.Sender().ID)
 				if e := db.DelUser(c.Sender().ID); e != nil {
 					log.Errorf("failed to delete user %d: %v", c.Sender().ID, e)
@@ -156,7 +184,7 @@ func errorInterceptor(next tb.HandlerFunc) tb.HandlerFunc {
 // SendMessage sends the given message to a Telegram user with the given ID
 // it's meant to be called from outside the package
 func SendMessage(userID int64, message interface{}, opt ...interface{}) *tb.Message {
-	msg, err := b.Send(tb.ChatID(userID), message, append(opt, tb.NoPreview)...)
+	msg, err := TrySendMessage(userID, message, opt...)
 	if err != nil {
 		log.Errorf("failed to send message to user %d: %s", userID, err)
 		return nil
@@ -164,6 +192,88 @@ func SendMessage(userID int64, message interface{}, opt ...interface{}) *tb.Mess
 	return msg
 }
 
+// TrySendMessage sends the given message to a Telegram user with the given ID, returning the error if it fails
+// it's meant to be called from outside the package, by callers which handle the failures themselves (e.g., to retry)
+func TrySendMessage(userID int64, message interface{}, opt ...interface{}) (*tb.Message, error) {
+	msg, err := b.Send(tb.ChatID(userID), message, append(opt, tb.NoPreview)...)
+	if err != nil && IsUserGoneError(err) {
+		markUserInactive(userID)
+	}
+	return msg, err
+}
+
+// IsUserGoneError reports whether the given error from Telegram Bot API means the user can't receive messages anymore,
+// i.e., they have blocked the bot or deleted their account
+func IsUserGoneError(err error) bool {
+	return errors.Is(err, tb.ErrBlockedByUser) || errors.Is(err, tb.ErrUserIsDeactivated)
+}
+
+// markUserInactive marks the user with the given ID as inactive (if not yet), so they're skipped by the jobs
+// until they send `/start` again
+func markUserInactive(userID int64) {
+	user, err := db.GetUser(userID)
+	if err != nil {
+		if err != db.ErrUserNotFound {
+			log.Errorf("failed to get user %d: %v", userID, err)
+		}
+		return
+	}
+	if user.InactiveSince != 0 {
+		return
+	}
+	user.InactiveSince = time.Now().Unix()
+	if err = db.PutUser(user); err != nil {
+		log.Errorf("failed to put user %d: %v", userID, err)
+		return
+	}
+	log.Infof("user %d has blocked the bot or deleted their account, marked as inactive", userID)
+}
+
+// telegramErrorCodeRegex matches the error code in the errors of Telegram Bot API unknown to telebot
+var telegramErrorCodeRegex = regexp.MustCompile(`^telegram: .* \((\d{3})\)$`)
+
+// IsTransientError reports whether the given error from Telegram Bot API is worth retrying, i.e.,
+// it's caused by flood control, Telegram's server or the network, rather than a rejection of the request
+// it also returns how long Telegram has asked to wait before retrying, if any
+func IsTransientError(err error) (bool, time.Duration) {
+	var floodErr tb.FloodError
+	if errors.As(err, &floodErr) {
+		return true, time.Duration(floodErr.RetryAfter) * time.Second
+	}
+	var tbErr *tb.Error
+	if errors.As(err, &tbErr) {
+		return tbErr.Code >= 500, 0
+	}
+	if m := telegramErrorCodeRegex.FindStringSubmatch(err.Error()); m != nil {
+		return m[1][0] == '5' || m[1] == "429", 0
+	}
+	return true, 0 // network errors
+}
+
+// EditMessage edits the text of a previously sent message with the given ID to a Telegram user with the given ID
+// it's meant to be called from outside the package, it doesn't treat an unchanged text as an error
+func EditMessage(userID int64, messageID int, text string, opt ...interface{}) error {
+	_, err := b.Edit(tb.StoredMessage{
+		MessageID: strconv.Itoa(messageID),
+		ChatID:    userID,
+	}, text, append(opt, tb.NoPreview)...)
+	if err != nil && IsUserGoneError(err) {
+		markUserInactive(userID)
+	}
+	if err != nil && !errors.Is(err, tb.ErrMessageNotModified) && !errors.Is(err, tb.ErrSameMessageContent) {
+		log.Errorf("failed to edit message %d to user %d: %s", messageID, userID, err)
+		return err
+	}
+	return nil
+}
+
+// PinMessage pins the given message in its chat
+func PinMessage(msg *tb.Message) {
+	if err := b.Pin(msg, tb.Silent); err != nil {
+		log.Errorf("failed to pin message %d to user %d: %v", msg.ID, msg.Chat.ID, err)
+	}
+}
+
 // DeleteLoginLinkMessage deletes the login link message of the given login session
 func DeleteLoginLinkMessage(s db.LoginSession) {
 	if err := b.Delete(tb.StoredMessage{
@@ -174,6 +284,14 @@ func DeleteLoginLinkMessage(s db.LoginSession) {
 	}
 }
 
+// NotifyAdmins sends the given message to all admins
+// it's meant to be called from outside the package
+func NotifyAdmins(message interface{}) {
+	for _, adminUID := range adminUIDs {
+		SendMessage(adminUID, message)
+	}
+}
+
 // adminOnly is a middleware that checks if the sender is an admin
 func adminOnly(next tb.HandlerFunc) tb.HandlerFunc {
 	return func(c tb.Context) (err error) {
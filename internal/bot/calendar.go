@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"RacoBot/pkg/fibapi"
+)
+
+const (
+	icsDateTimeLayout = "20060102T150405"
+	icsLineMaxLength  = 75 // in octets, excluding the line break
+)
+
+// icsTextEscaper escapes TEXT property values as specified in RFC 5545 section 3.3.11
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icsTimezoneMadrid is the VTIMEZONE component of Europe/Madrid referenced by the events' TZID parameters
+var icsTimezoneMadrid = []string{
+	"BEGIN:VTIMEZONE",
+	"TZID:Europe/Madrid",
+	"BEGIN:DAYLIGHT",
+	"TZOFFSETFROM:+0100",
+	"TZOFFSETTO:+0200",
+	"TZNAME:CEST",
+	"DTSTART:19700329T020000",
+	"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU",
+	"END:DAYLIGHT",
+	"BEGIN:STANDARD",
+	"TZOFFSETFROM:+0200",
+	"TZOFFSETTO:+0100",
+	"TZNAME:CET",
+	"DTSTART:19701025T030000",
+	"RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU",
+	"END:STANDARD",
+	"END:VTIMEZONE",
+}
+
+// CalendarFeed represents an iCalendar (RFC 5545) feed of a user's weekly classes
+type CalendarFeed struct {
+	Classes []fibapi.Class
+	UserID  int64
+	Now     time.Time // the classes recur weekly starting from the week of this time
+}
+
+// String formats a CalendarFeed to an iCalendar object, with every class as a weekly recurring event
+func (f *CalendarFeed) String() string {
+	now := f.Now.In(tzMadrid)
+	monday := now.AddDate(0, 0, -((int(now.Weekday()) + 6) % 7)) // the Monday of this week
+	dtStamp := now.UTC().Format(icsDateTimeLayout) + "Z"
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//RacoBot//Class Schedule//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:Racó",
+		"X-WR-TIMEZONE:Europe/Madrid",
+	}
+	lines = append(lines, icsTimezoneMadrid...)
+
+	for _, c := range f.Classes {
+		date := monday.AddDate(0, 0, (int(c.Weekday())+6)%7)
+		start, err := c.Start(date)
+		if err != nil {
+			continue
+		}
+		end, _ := c.End(date)
+
+		summary := fmt.Sprintf("%s %s %s", c.SubjectCode, c.Types, c.Group)
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%d-%s-%s-%s-%d-%s@racobot", f.UserID, c.SubjectCode, c.Group, c.Types, c.DayOfWeek, strings.ReplaceAll(c.StartTime, ":", "")),
+			"DTSTAMP:"+dtStamp,
+			"DTSTART;TZID=Europe/Madrid:"+start.Format(icsDateTimeLayout),
+			"DTEND;TZID=Europe/Madrid:"+end.Format(icsDateTimeLayout),
+			"RRULE:FREQ=WEEKLY",
+			"SUMMARY:"+icsTextEscaper.Replace(strings.TrimSpace(summary)),
+		)
+		if c.Classrooms != "" {
+			lines = append(lines, "LOCATION:"+icsTextEscaper.Replace(c.Classrooms))
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	var sb strings.Builder
+	for _, line := range lines {
+		writeICSLine(&sb, line)
+	}
+	return sb.String()
+}
+
+// writeICSLine writes a content line, folded to lines of at most 75 octets without splitting UTF-8 characters
+func writeICSLine(sb *strings.Builder, line string) {
+	limit := icsLineMaxLength
+	for len(line) > limit {
+		i := limit
+		for i > 0 && line[i]&0xC0 == 0x80 { // don't split in the middle of a multibyte character
+			i--
+		}
+		sb.WriteString(line[:i])
+		sb.WriteString("\r\n ")
+		line = line[i:]
+		limit = icsLineMaxLength - 1 // continuation lines start with a space
+	}
+	sb.WriteString(line)
+	sb.WriteString("\r\n")
+}
@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"RacoBot/pkg/fibapi"
+)
+
+func TestCalendarFeed_String(t *testing.T) {
+	f := &CalendarFeed{
+		Classes: []fibapi.Class{
+			{DayOfWeek: 1, Duration: 2, SubjectCode: "IES", Group: "10", StartTime: "08:00", Types: "T", Classrooms: "A5201"},
+			{DayOfWeek: 3, Duration: 1, SubjectCode: "PROP", Group: "12", StartTime: "12:00", Types: "L", Classrooms: "A5S108,A5S109"},
+		},
+		UserID: 12345,
+		Now:    time.Date(2024, 2, 14, 9, 30, 0, 0, tzMadrid), // a Wednesday
+	}
+
+	want := strings.Join(append(append([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//RacoBot//Class Schedule//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:Racó",
+		"X-WR-TIMEZONE:Europe/Madrid",
+	}, icsTimezoneMadrid...),
+		"BEGIN:VEVENT",
+		"UID:12345-IES-10-T-1-0800@racobot",
+		"DTSTAMP:20240214T083000Z",
+		"DTSTART;TZID=Europe/Madrid:20240212T080000",
+		"DTEND;TZID=Europe/Madrid:20240212T100000",
+		"RRULE:FREQ=WEEKLY",
+		"SUMMARY:IES T 10",
+		"LOCATION:A5201",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:12345-PROP-12-L-3-1200@racobot",
+		"DTSTAMP:20240214T083000Z",
+		"DTSTART;TZID=Europe/Madrid:20240214T120000",
+		"DTEND;TZID=Europe/Madrid:20240214T130000",
+		"RRULE:FREQ=WEEKLY",
+		"SUMMARY:PROP L 12",
+		`LOCATION:A5S108\,A5S109`,
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	), "\r\n")
+
+	if got := f.String(); got != want {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestWriteICSLine(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("à", 40) // 8 + 80 octets
+	var sb strings.Builder
+	writeICSLine(&sb, line)
+
+	got := sb.String()
+	want := "SUMMARY:" + strings.Repeat("à", 33) + "\r\n " + strings.Repeat("à", 7) + "\r\n"
+	if got != want {
+		t.Error(cmp.Diff(want, got))
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+		if len(l) > icsLineMaxLength {
+			t.Errorf("line too long (%d octets): %q", len(l), l)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"html"
+	"slices"
+	"strings"
+)
+
+// diffContextWords is the number of unchanged words kept around each change in a word diff
+const diffContextWords = 3
+
+// diffMaxCells is the max size of the LCS table in a word diff, beyond which the texts are treated as entirely replaced
+const diffMaxCells = 1 << 22
+
+// diffWords makes a word-level diff of the given texts in Telegram HTML, with removed words in `<s>` and added ones in `<b>`,
+// long runs of unchanged words are elided, and the result is cut (at a word boundary) to be no longer than maxLength
+func diffWords(oldText, newText string, maxLength int) string {
+	a, b := strings.Fields(oldText), strings.Fields(newText)
+
+	// trim the common prefix and suffix to shrink the LCS table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, w := range a[:prefix] {
+		ops = append(ops, diffOp{diffEqual, w})
+	}
+	ops = append(ops, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, w := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{diffEqual, w})
+	}
+
+	var sb strings.Builder
+	write := func(s string) bool {
+		if sb.Len()+len(s) > maxLength {
+			return false
+		}
+		sb.WriteString(s)
+		return true
+	}
+	for i := 0; i < len(ops); {
+		j := i
+		for j < len(ops) && ops[j].kind == ops[i].kind {
+			j++
+		}
+		words := make([]string, 0, j-i)
+		for _, op := range ops[i:j] {
+			words = append(words, html.EscapeString(op.word))
+		}
+
+		var s string
+		switch ops[i].kind {
+		case diffEqual:
+			if len(words) > 2*diffContextWords+1 { // elide the middle of a long unchanged run
+				var parts []string
+				if i > 0 {
+					parts = append(parts, words[:diffContextWords]...)
+				}
+				parts = append(parts, "…")
+				if j < len(ops) {
+					parts = append(parts, words[len(words)-diffContextWords:]...)
+				}
+				words = parts
+			}
+			s = strings.Join(words, " ")
+		case diffDelete:
+			s = "<s>" + strings.Join(words, " ") + "</s>"
+		case diffInsert:
+			s = "<b>" + strings.Join(words, " ") + "</b>"
+		}
+		if i > 0 {
+			s = " " + s
+		}
+		if !write(s) {
+			write(" …")
+			break
+		}
+		i = j
+	}
+	return sb.String()
+}
+
+// diffKind represents the kind of a diffOp
+type diffKind uint8
+
+// diff operation kinds
+const (
+	diffEqual diffKind = iota
+	diffDelete
+	diffInsert
+)
+
+// diffOp represents a word in a word diff
+type diffOp struct {
+	kind diffKind
+	word string
+}
+
+// lcsDiff makes a word diff of the given word lists based on their longest common subsequence
+func lcsDiff(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	if len(a)*len(b) > diffMaxCells { // too expensive, treat them as entirely replaced
+		for _, w := range a {
+			ops = append(ops, diffOp{diffDelete, w})
+		}
+		for _, w := range b {
+			ops = append(ops, diffOp{diffInsert, w})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{diffEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{diffDelete, a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{diffInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{diffDelete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{diffInsert, b[j]})
+	}
+	return ops
+}
+
+// diffSets returns the elements added to and removed from the given old list in the given new list
+func diffSets(old, new []string) (added, removed []string) {
+	for _, s := range new {
+		if !slices.Contains(old, s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range old {
+		if !slices.Contains(new, s) {
+			removed = append(removed, s)
+		}
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffWords(t *testing.T) {
+	type test struct {
+		old, new  string
+		maxLength int
+		want      string
+	}
+	tests := []test{
+		{
+			"L'examen serà a l'aula A5001",
+			"L'examen serà a l'aula A6101",
+			100,
+			"L&#39;examen serà a l&#39;aula <s>A5001</s> <b>A6101</b>",
+		},
+		{
+			"one two three four five six seven eight nine ten changed eleven",
+			"one two three four five six seven eight nine ten eleven twelve",
+			100,
+			"… eight nine ten <s>changed</s> eleven <b>twelve</b>",
+		},
+		{
+			"a b c d e f g h i j k l m n o p",
+			"a b c X e f g h i j k l m Y o p",
+			100,
+			"a b c <s>d</s> <b>X</b> e f g … k l m <s>n</s> <b>Y</b> o p",
+		},
+		{
+			"<b>old</b>",
+			"<b>new</b>",
+			100,
+			"<s>&lt;b&gt;old&lt;/b&gt;</s> <b>&lt;b&gt;new&lt;/b&gt;</b>",
+		},
+		{
+			"a b",
+			"a c d e f g h i j k l",
+			30,
+			"a <s>b</s> …",
+		},
+	}
+
+	for _, tc := range tests {
+		got := diffWords(tc.old, tc.new, tc.maxLength)
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%q -> %q: mismatch (-want +got):\n%s", tc.old, tc.new, diff)
+		}
+	}
+}
+
+func TestDiffSets(t *testing.T) {
+	added, removed := diffSets([]string{"a.pdf", "b.pdf"}, []string{"b.pdf", "c.pdf"})
+	if diff := cmp.Diff([]string{"c.pdf"}, added); diff != "" {
+		t.Errorf("added mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"a.pdf"}, removed); diff != "" {
+		t.Errorf("removed mismatch (-want +got):\n%s", diff)
+	}
+}
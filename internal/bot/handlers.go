@@ -1,6 +1,12 @@
 package bot
 
 import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -14,9 +20,28 @@ import (
 	"RacoBot/pkg/fibapi"
 )
 
+// maxClassReminderMinutes is the maximum number of minutes a class reminder can be sent in advance
+const maxClassReminderMinutes = 120
+
+// subjectCodeRegex matches a valid subject code (acronym) given in command payloads
+var subjectCodeRegex = regexp.MustCompile(`^[A-Z0-9][A-Z0-9-]{0,19}$`)
+
 // start replies with a `/login` message
 // on command `/start`
 func start(c tb.Context) error {
+	// reactivate the user if they had blocked the bot or deleted their account
+	user, err := db.GetUser(c.Sender().ID)
+	if err != nil && err != db.ErrUserNotFound {
+		log.Errorf("failed to get user %d: %v", c.Sender().ID, err)
+	}
+	if err == nil && user.InactiveSince != 0 {
+		user.InactiveSince = 0
+		if err = db.PutUser(user); err != nil {
+			log.Errorf("failed to put user %d: %v", c.Sender().ID, err)
+		} else {
+			log.Infof("user %d has been reactivated", c.Sender().ID)
+		}
+	}
 	return c.Send(locale.Get(c.Sender().LanguageCode).StartMessage)
 }
 
@@ -76,7 +101,7 @@ func login(c tb.Context) error {
 func whoami(c tb.Context) error {
 	fullName, err := NewClient(c.Sender().ID).GetFullName()
 	if err != nil {
-		if err == ErrUserNotFound || err == fibapi.ErrAuthorizationExpired {
+		if err == ErrUserNotFound || errors.Is(err, fibapi.ErrAuthorizationExpired) {
 			return err
 		}
 		log.Errorf("failed to get full name of user %d: %v", c.Sender().ID, err)
@@ -93,7 +118,7 @@ func logout(c tb.Context) error {
 		return ErrUserNotFound
 	}
 	if err := client.Logout(); err != nil {
-		if err == fibapi.ErrAuthorizationExpired {
+		if errors.Is(err, fibapi.ErrAuthorizationExpired) {
 			return err
 		}
 		log.Errorf("failed to logout user %d: %v", c.Sender().ID, err)
@@ -138,29 +163,56 @@ func test(c tb.Context) error {
 	if client == nil {
 		return ErrUserNotFound
 	}
-	notices, err := client.PrivateClient.GetNotices()
+	notices, err := client.PrivateClient.GetNoticesContext(client.ctx)
 	if err != nil {
-		if err == fibapi.ErrAuthorizationExpired {
+		if errors.Is(err, fibapi.ErrAuthorizationExpired) {
 			return err
 		}
 		log.Errorf("failed to get notices of user %d: %v", c.Sender().ID, err)
 		return ErrInternal
 	}
 
-	defer func() { // save states to DB by the way
-		if len(notices) > 0 {
-			client.User.LastNoticeTimestamp = notices[len(notices)-1].PublishedAt.Unix()
-			if e := db.PutUser(client.User); e != nil {
-				log.Errorf("failed to put user %d: %v", c.Sender().ID, e)
-			}
+	if !client.User.SeenNoticesSeeded { // save states to DB by the way
+		if _, err = client.seedSeenNotices(notices); err != nil {
+			log.Errorf("failed to seed seen notices of user %d: %v", c.Sender().ID, err)
 		}
-	}()
+	}
 
 	if len(notices) == 0 {
 		return c.Send(&ErrorMessage{locale.Get(client.User.LanguageCode).NoAvailableNoticesErrorMessage})
 	}
 	latestNotice := notices[len(notices)-1]
-	return c.Send(&NoticeMessage{latestNotice, client.User, getNoticeLinkURL(latestNotice)})
+	return c.Send(&NoticeMessage{Notice: latestNotice, User: client.User, linkURL: getNoticeLinkURL(client.ctx, latestNotice)})
+}
+
+// schedule replies with the user's class schedule of the week, or of a single day if specified in payload
+// on command `/schedule [today|tomorrow]`
+func schedule(c tb.Context) error {
+	client := NewClient(c.Sender().ID)
+	if client == nil {
+		return ErrUserNotFound
+	}
+
+	var date time.Time
+	switch strings.ToLower(strings.TrimSpace(c.Message().Payload)) {
+	case "": // the whole week
+	case "today":
+		date = time.Now().In(tzMadrid)
+	case "tomorrow":
+		date = time.Now().In(tzMadrid).AddDate(0, 0, 1)
+	default:
+		return c.Send(&ErrorMessage{locale.Get(client.User.LanguageCode).ScheduleCommandUsageErrorMessage})
+	}
+
+	classes, err := client.GetSchedule()
+	if err != nil {
+		if errors.Is(err, fibapi.ErrAuthorizationExpired) {
+			return err
+		}
+		log.Errorf("failed to get schedule of user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	return c.Send(&ScheduleMessage{classes, client.User, date})
 }
 
 // setPreferredLanguage replies with the menu of supported languages for the user to select from on command `/lang`,
@@ -202,30 +254,431 @@ func publishAnnouncement(c tb.Context) error {
 
 	go func(announcement AnnouncementMessage) {
 		logger := log.WithField("job", "PublishAnnouncement")
-		count := 0
-
-		userIDs, err := db.GetAllUserIDs()
-		if err != nil {
-			logger.Errorf("failed to get all user IDs: %v", err)
-			return
-		}
-		logger.Infof("found %d users", len(userIDs))
+		count, userCount := 0, 0
 
 		startTime := time.Now()
-		for _, userID := range userIDs {
-			if _, err = b.Send(tb.ChatID(userID), &announcement); err != nil {
+		users := db.NewUserIDIterator()
+		for users.Next() {
+			userID := users.UserID()
+			userCount++
+			if _, err := b.Send(tb.ChatID(userID), &announcement); err != nil {
 				logger.Errorf("failed to send announcement to user %d: %v", userID, err)
 				continue
 			}
 			count++
 		}
+		if err := users.Err(); err != nil {
+			logger.Errorf("failed to get user IDs: %v", err)
+		}
 
-		logger.Infof("sent announcement to %d/%d users in %v", count, len(userIDs), time.Since(startTime))
+		logger.Infof("sent announcement to %d/%d users in %v", count, userCount, time.Since(startTime))
 	}(m)
 
 	return c.Send("Started publishing announcement")
 }
 
+// deadLettersListSize is the max number of dead letters listed by `/dead_letters`
+const deadLettersListSize = 10
+
+// status replies with whether FIB API is available, i.e., whether new notices are being delivered
+// on command `/status`
+// it's the status announced by the leader instance, as this one may make too few requests to notice an outage
+func status(c tb.Context) error {
+	languageCode := c.Sender().LanguageCode
+	if user, err := db.GetUser(c.Sender().ID); err == nil {
+		languageCode = user.LanguageCode
+	}
+	s, ok, err := GetAnnouncedFIBAPIStatus()
+	if err != nil {
+		log.Errorf("failed to get announced FIB API status: %v", err)
+	}
+	if !ok {
+		s = fibapi.GetBreakerStatus()
+	}
+	return c.Send(&StatusMessage{LanguageCode: languageCode, Status: s})
+}
+
+// listDeadLetters replies with the latest dead letters (notices given up on delivering)
+// on command `/dead_letters`
+func listDeadLetters(c tb.Context) error {
+	deadLetters, total, err := db.GetDeadLetters(deadLettersListSize)
+	if err != nil {
+		log.Errorf("failed to get dead letters: %v", err)
+		return ErrInternal
+	}
+	return c.Send(&DeadLettersMessage{DeadLetters: deadLetters, Total: total})
+}
+
+// toggleDailySchedule toggles whether the user receives their classes of the day every morning
+// on command `/toggle_daily_schedule`
+func toggleDailySchedule(c tb.Context) error {
+	user, err := db.GetUser(c.Sender().ID)
+	if err != nil {
+		if err == db.ErrUserNotFound {
+			return ErrUserNotFound
+		}
+		log.Errorf("failed to get user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+
+	user.DailySchedule = !user.DailySchedule
+	if err = db.PutUser(user); err != nil {
+		log.Errorf("failed to put user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+
+	if user.DailySchedule {
+		return c.Send(locale.Get(user.LanguageCode).DailyScheduleEnabledMessage)
+	} else {
+		return c.Send(locale.Get(user.LanguageCode).DailyScheduleDisabledMessage)
+	}
+}
+
+// exams replies with the user's upcoming exams
+// on command `/exams`
+func exams(c tb.Context) error {
+	client := NewClient(c.Sender().ID)
+	if client == nil {
+		return ErrUserNotFound
+	}
+
+	upcoming, err := client.GetExams()
+	if err != nil {
+		if errors.Is(err, fibapi.ErrAuthorizationExpired) {
+			return err
+		}
+		log.Errorf("failed to get exams of user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	return c.Send(&ExamsMessage{upcoming, client.User})
+}
+
+// toggleExamReminders toggles whether the user gets reminded of the exams of the subject given in payload,
+// or replies with the subjects muted currently if no payload is given
+// on command `/toggle_exam_reminders <subject>`
+func toggleExamReminders(c tb.Context) error {
+	user, err := db.GetUser(c.Sender().ID)
+	if err != nil {
+		if err == db.ErrUserNotFound {
+			return ErrUserNotFound
+		}
+		log.Errorf("failed to get user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	l := locale.Get(user.LanguageCode)
+
+	subject := strings.ToUpper(strings.TrimSpace(c.Message().Payload))
+	if !subjectCodeRegex.MatchString(subject) {
+		muted := "-"
+		if len(user.MutedExamSubjects) > 0 {
+			muted = strings.Join(user.MutedExamSubjects, ", ")
+		}
+		return c.Send(fmt.Sprintf(l.ExamRemindersUsageMessage, muted))
+	}
+
+	if i := slices.Index(user.MutedExamSubjects, subject); i >= 0 {
+		user.MutedExamSubjects = slices.Delete(user.MutedExamSubjects, i, i+1)
+	} else {
+		user.MutedExamSubjects = append(user.MutedExamSubjects, subject)
+	}
+	if err = db.PutUser(user); err != nil {
+		log.Errorf("failed to put user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+
+	if slices.Contains(user.MutedExamSubjects, subject) {
+		return c.Send(fmt.Sprintf(l.ExamRemindersMutedMessage, subject))
+	} else {
+		return c.Send(fmt.Sprintf(l.ExamRemindersUnmutedMessage, subject))
+	}
+}
+
+// setClassReminders sets how many minutes in advance the user gets reminded before each class starts (0 to disable),
+// or replies with the current setting if no payload is given
+// on command `/class_reminders [minutes]`
+func setClassReminders(c tb.Context) error {
+	user, err := db.GetUser(c.Sender().ID)
+	if err != nil {
+		if err == db.ErrUserNotFound {
+			return ErrUserNotFound
+		}
+		log.Errorf("failed to get user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	l := locale.Get(user.LanguageCode)
+
+	if payload := strings.TrimSpace(c.Message().Payload); payload != "" {
+		minutes, err := strconv.ParseUint(payload, 10, 16)
+		if err != nil || minutes > maxClassReminderMinutes {
+			return c.Send(&ErrorMessage{fmt.Sprintf(l.ClassRemindersUsageErrorMessage, maxClassReminderMinutes)})
+		}
+		user.ClassReminderMinutes = uint16(minutes)
+		if err = db.PutUser(user); err != nil {
+			log.Errorf("failed to put user %d: %v", c.Sender().ID, err)
+			return ErrInternal
+		}
+
+		// schedule reminders for the rest of today's classes right away
+		if user.ClassReminderMinutes != 0 {
+			if _, err = NewClient(user.ID).ScheduleClassReminders(time.Now().In(tzMadrid)); err != nil {
+				if errors.Is(err, fibapi.ErrAuthorizationExpired) {
+					return err
+				}
+				log.Errorf("failed to schedule class reminders of user %d: %v", c.Sender().ID, err)
+			}
+		}
+	}
+
+	if user.ClassReminderMinutes == 0 {
+		return c.Send(l.ClassRemindersDisabledMessage)
+	}
+	return c.Send(fmt.Sprintf(l.ClassRemindersEnabledMessage, user.ClassReminderMinutes))
+}
+
+// calendar replies with the URL of the user's private iCalendar feed of classes,
+// a new URL is generated (revoking the previous one) if the user doesn't have one yet or if `rotate` is given in payload
+// on command `/calendar [rotate]`
+func calendar(c tb.Context) error {
+	user, err := db.GetUser(c.Sender().ID)
+	if err != nil {
+		if err == db.ErrUserNotFound {
+			return ErrUserNotFound
+		}
+		log.Errorf("failed to get user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	l := locale.Get(user.LanguageCode)
+
+	payload := strings.ToLower(strings.TrimSpace(c.Message().Payload))
+	if payload != "" && payload != "rotate" {
+		return c.Send(&ErrorMessage{l.CalendarCommandUsageErrorMessage})
+	}
+	if user.CalendarToken == "" || payload == "rotate" {
+		if err = db.RotateCalendarToken(&user); err != nil {
+			log.Errorf("failed to rotate calendar token of user %d: %v", c.Sender().ID, err)
+			return ErrInternal
+		}
+	}
+
+	feedURL := CalendarFeedURL + url.Values{"token": {user.CalendarToken}}.Encode()
+	return c.Send(fmt.Sprintf(l.CalendarFeedMessage, html.EscapeString(feedURL)), tb.NoPreview)
+}
+
+// noticeSettings replies with a menu of the user's subjects for setting how their notices are delivered,
+// pruning the settings of the subjects they are no longer enrolled in, see switchNoticeMode for the menu's callbacks
+// on command `/notice_settings`
+func noticeSettings(c tb.Context) error {
+	if c.Callback() != nil {
+		return switchNoticeMode(c)
+	}
+
+	client := NewClient(c.Sender().ID)
+	if client == nil {
+		return ErrUserNotFound
+	}
+	l := locale.Get(client.User.LanguageCode)
+
+	subjects, err := client.GetSubjects()
+	if err != nil {
+		if errors.Is(err, fibapi.ErrAuthorizationExpired) {
+			return err
+		}
+		log.Errorf("failed to get subjects of user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	if err = client.PruneSubjectSettings(subjects); err != nil {
+		log.Errorf("failed to prune subject settings of user %d: %v", c.Sender().ID, err)
+	}
+	if len(subjects) == 0 {
+		return c.Send(&ErrorMessage{l.NoSubjectsErrorMessage})
+	}
+
+	codes := make([]string, len(subjects))
+	for i, s := range subjects {
+		codes[i] = s.ID
+	}
+	return c.Send(l.NoticeSettingsMenuText, newNoticeSettingsMenu(codes, client.User))
+}
+
+// switchNoticeMode switches the notice mode of the subject with the given button data to the next one,
+// the subjects are taken from the menu tapped instead of being requested to FIB API on every tap
+// on callback &noticeModeButton
+func switchNoticeMode(c tb.Context) error {
+	defer func() { _ = c.Respond() }() // stop the button's loading indicator whatever happens
+
+	user, err := db.GetUser(c.Sender().ID)
+	if err != nil {
+		if err == db.ErrUserNotFound {
+			return ErrUserNotFound
+		}
+		log.Errorf("failed to get user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+
+	code := c.Callback().Data
+	codes := noticeSettingsMenuCodes(c.Callback().Message)
+	if !slices.Contains(codes, code) {
+		return nil
+	}
+	mode := (user.NoticeModeOf(code) + 1) % (db.NoticeModeDrop + 1)
+	if mode == db.NoticeModeDeliver {
+		delete(user.SubjectNoticeModes, code)
+	} else {
+		if user.SubjectNoticeModes == nil {
+			user.SubjectNoticeModes = make(map[string]db.NoticeMode)
+		}
+		user.SubjectNoticeModes[code] = mode
+	}
+	if err = db.PutUser(user); err != nil {
+		log.Errorf("failed to put user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	return c.Edit(locale.Get(user.LanguageCode).NoticeSettingsMenuText, newNoticeSettingsMenu(codes, user))
+}
+
+// noticeModeIcons are the icons of notice modes shown on the buttons of notice settings menus
+var noticeModeIcons = map[db.NoticeMode]string{
+	db.NoticeModeDeliver:         "🔔",
+	db.NoticeModeDeliverSilently: "🔕",
+	db.NoticeModeDrop:            "🚫",
+}
+
+// newNoticeSettingsMenu creates a menu with a button for each of the given subject codes showing its current notice mode
+func newNoticeSettingsMenu(codes []string, user db.User) *tb.ReplyMarkup {
+	menu := &tb.ReplyMarkup{}
+	rows := make([]tb.Row, 0, (len(codes)+1)/2)
+	for i := 0; i < len(codes); i += 2 { // 2 buttons per row
+		row := tb.Row{}
+		for _, code := range codes[i:min(i+2, len(codes))] {
+			text := fmt.Sprintf("%s %s", noticeModeIcons[user.NoticeModeOf(code)], code)
+			row = append(row, menu.Data(text, noticeModeButton.Unique, code))
+		}
+		rows = append(rows, row)
+	}
+	menu.Inline(rows...)
+	return menu
+}
+
+// noticeSettingsMenuCodes returns the subject codes of the buttons of the notice settings menu in the given message
+func noticeSettingsMenuCodes(m *tb.Message) []string {
+	if m == nil || m.ReplyMarkup == nil {
+		return nil
+	}
+	var codes []string
+	for _, row := range m.ReplyMarkup.InlineKeyboard {
+		for _, button := range row {
+			// button data is `\f<unique>|<subject code>`, see tb.ReplyMarkup.Data
+			unique, code, ok := strings.Cut(strings.TrimPrefix(button.Data, "\f"), "|")
+			if ok && unique == noticeModeButton.Unique {
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes
+}
+
+// addAlertRule adds the alert rule given in payload for the user
+// on command `/add_rule /<pattern>/[i] [loud] [pin] [prefix <text>]`
+func addAlertRule(c tb.Context) error {
+	user, err := db.GetUser(c.Sender().ID)
+	if err != nil {
+		if err == db.ErrUserNotFound {
+			return ErrUserNotFound
+		}
+		log.Errorf("failed to get user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	l := locale.Get(user.LanguageCode)
+
+	rule, err := ParseAlertRule(c.Message().Payload)
+	if err != nil {
+		switch err {
+		case ErrInvalidAlertRule:
+			return c.Send(&ErrorMessage{l.AddAlertRuleUsageErrorMessage})
+		case ErrAlertRulePatternTooLong:
+			return c.Send(&ErrorMessage{fmt.Sprintf(l.AlertRulePatternTooLongErrorMessage, maxAlertRulePatternLength)})
+		case ErrAlertRulePrefixTooLong:
+			return c.Send(&ErrorMessage{fmt.Sprintf(l.AlertRulePrefixTooLongErrorMessage, maxAlertRulePrefixLength)})
+		default: // regular expression syntax error
+			return c.Send(&ErrorMessage{fmt.Sprintf(l.AlertRuleInvalidPatternErrorMessage, html.EscapeString(err.Error()))})
+		}
+	}
+
+	rules, err := db.GetAlertRules(user.ID)
+	if err != nil {
+		log.Errorf("failed to get alert rules of user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	if len(rules) >= maxAlertRules {
+		return c.Send(&ErrorMessage{fmt.Sprintf(l.AlertRulesLimitErrorMessage, maxAlertRules)})
+	}
+	if err = db.PutAlertRules(user.ID, append(rules, rule)); err != nil {
+		log.Errorf("failed to put alert rules of user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	return c.Send(l.AlertRuleAddedMessage)
+}
+
+// listAlertRules replies with the user's alert rules
+// on command `/rules`
+func listAlertRules(c tb.Context) error {
+	user, err := db.GetUser(c.Sender().ID)
+	if err != nil {
+		if err == db.ErrUserNotFound {
+			return ErrUserNotFound
+		}
+		log.Errorf("failed to get user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	l := locale.Get(user.LanguageCode)
+
+	rules, err := db.GetAlertRules(user.ID)
+	if err != nil {
+		log.Errorf("failed to get alert rules of user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	if len(rules) == 0 {
+		return c.Send(&ErrorMessage{l.NoAlertRulesErrorMessage})
+	}
+
+	var sb strings.Builder
+	sb.WriteString(l.AlertRulesListHeader)
+	for i, r := range rules {
+		fmt.Fprintf(&sb, "\n%d. <code>%s</code>", i+1, formatAlertRule(r))
+	}
+	return c.Send(sb.String())
+}
+
+// delAlertRule deletes the user's alert rule with the number (as listed by `/rules`) given in payload
+// on command `/del_rule <number>`
+func delAlertRule(c tb.Context) error {
+	user, err := db.GetUser(c.Sender().ID)
+	if err != nil {
+		if err == db.ErrUserNotFound {
+			return ErrUserNotFound
+		}
+		log.Errorf("failed to get user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	l := locale.Get(user.LanguageCode)
+
+	rules, err := db.GetAlertRules(user.ID)
+	if err != nil {
+		log.Errorf("failed to get alert rules of user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(c.Message().Payload))
+	if err != nil || i < 1 || i > len(rules) {
+		return c.Send(&ErrorMessage{l.DelAlertRuleUsageErrorMessage})
+	}
+
+	if err = db.PutAlertRules(user.ID, slices.Delete(rules, i-1, i)); err != nil {
+		log.Errorf("failed to put alert rules of user %d: %v", c.Sender().ID, err)
+		return ErrInternal
+	}
+	return c.Send(l.AlertRuleDeletedMessage)
+}
+
 // toggleMuteBannerNotices toggles the user's mute state for banner notices
 // on command `/toggle_mute_banner_notices`
 func toggleMuteBannerNotices(c tb.Context) error {
@@ -0,0 +1,22 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	tb "gopkg.in/telebot.v3"
+)
+
+func TestNoticeSettingsMenuCodes(t *testing.T) {
+	// as received from Telegram, with the unique and data of each button joined in its callback data
+	m := &tb.Message{ReplyMarkup: &tb.ReplyMarkup{InlineKeyboard: [][]tb.InlineButton{
+		{{Text: "🔔 IES", Data: "\fnotice_mode|IES"}, {Text: "🚫 PROP", Data: "\fnotice_mode|PROP"}},
+		{{Text: "🔕 XC", Data: "\fnotice_mode|XC"}, {Text: "other", Data: "\fother|AC"}},
+	}}}
+	if diff := cmp.Diff([]string{"IES", "PROP", "XC"}, noticeSettingsMenuCodes(m)); diff != "" {
+		t.Errorf("noticeSettingsMenuCodes() mismatch (-want +got):\n%s", diff)
+	}
+	if codes := noticeSettingsMenuCodes(&tb.Message{}); codes != nil {
+		t.Errorf("message without menu: got %v", codes)
+	}
+}
@@ -1,13 +1,16 @@
 package bot
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"html"
 	"net/url"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	hr "github.com/coolspring8/go-lolhtml" // HTMLRewriter
 	log "github.com/sirupsen/logrus"
@@ -35,11 +38,16 @@ type NoticeMessage struct {
 	fibapi.Notice
 	User    db.User
 	linkURL string
+	Prefix  string // prepended to the message, e.g., by the user's alert rules
 }
 
-// Send sends a NoticeMessage
+// Send sends a NoticeMessage, respecting the given options (e.g., tb.Silent)
 func (m *NoticeMessage) Send(b *tb.Bot, to tb.Recipient, opt *tb.SendOptions) (*tb.Message, error) {
-	return b.Send(to, m.String(), tb.NoPreview)
+	if opt == nil {
+		opt = &tb.SendOptions{}
+	}
+	opt.DisableWebPagePreview = true
+	return b.Send(to, m.String(), opt)
 }
 
 const (
@@ -47,8 +55,20 @@ const (
 	racoBaseURL           string = "https://raco.fib.upc.edu"
 	racoNoticeURLTemplate string = "https://raco.fib.upc.edu/avisos/veure.jsp?espai=%d&id=%d"
 	datetimeLayout        string = "02/01/2006 15:04:05"
+	dateLayout            string = "02/01/2006"
+	clockLayout           string = "15:04"
 )
 
+var tzMadrid *time.Location
+
+// init initializes the Madrid timezone used for formatting time&date in messages
+func init() {
+	var err error
+	if tzMadrid, err = time.LoadLocation("Europe/Madrid"); err != nil {
+		panic(err)
+	}
+}
+
 var (
 	htmlCommentRegex = regexp.MustCompile(`<!--.*?-->`)
 	// HTML tags currently supported in Telegram API
@@ -256,24 +276,18 @@ func (m *NoticeMessage) String() string {
 		m.Title,
 		m.PublishedAt.Format(datetimeLayout),
 		fmt.Sprintf("<a href=\"%s\">%s</a>", m.linkURL, l.NoticeMessageOriginalLinkText))
+	if m.Prefix != "" {
+		header = html.EscapeString(m.Prefix) + " " + header
+	}
 	sb.WriteString(header)
 
 	// format body text
 	if m.Text != "" {
-		text, err := hr.RewriteString(m.Text, &htmlRewriterHandlers)
+		text, err := formatNoticeText(m.Text)
 		if err != nil {
 			log.Errorf("error rewriting notice message text HTML: %v", err)
 			return fmt.Sprintf("%s\n\n%s", header, l.InternalErrorMessage)
 		}
-
-		// unescape HTML entities except `&lt;`, `&gt;`, `&amp;` and `&quot;`
-		// FIXME: too janky
-		text = htmlEntityReplaceExcluder.Replace(text)
-		text = html.UnescapeString(text) // unescape other HTML entities
-		text = htmlEntityReplaceRestorer.Replace(text)
-
-		text = htmlCommentRegex.ReplaceAllString(text, "") // remove HTML comments
-		text = strings.Trim(text, "\n\r")                  // remove trailing newlines
 		sb.WriteString("\n\n")
 		sb.WriteString(text)
 	}
@@ -308,6 +322,96 @@ func (m *NoticeMessage) String() string {
 	return sb.String()
 }
 
+// formatNoticeText rewrites the given notice text HTML to the subset supported by Telegram
+func formatNoticeText(text string) (string, error) {
+	text, err := hr.RewriteString(text, &htmlRewriterHandlers)
+	if err != nil {
+		return "", err
+	}
+
+	// unescape HTML entities except `&lt;`, `&gt;`, `&amp;` and `&quot;`
+	// FIXME: too janky
+	text = htmlEntityReplaceExcluder.Replace(text)
+	text = html.UnescapeString(text) // unescape other HTML entities
+	text = htmlEntityReplaceRestorer.Replace(text)
+
+	text = htmlCommentRegex.ReplaceAllString(text, "") // remove HTML comments
+	text = strings.Trim(text, "\n\r")                  // remove trailing newlines
+	return text, nil
+}
+
+// Snapshot makes a NoticeSnapshot of the NoticeMessage's content (title, plain text and attachment names) with its hash,
+// for telling what has changed when it's modified
+func (m *NoticeMessage) Snapshot() db.NoticeSnapshot {
+	text, err := formatNoticeText(m.Text)
+	if err != nil {
+		log.Errorf("error rewriting notice message text HTML: %v", err)
+		text = m.Text
+	}
+	text = html.UnescapeString(htmlTagRegex.ReplaceAllString(text, ""))
+
+	attachments := make([]string, 0, len(m.Attachments))
+	for _, a := range m.Attachments {
+		attachments = append(attachments, a.Name)
+	}
+	sort.Strings(attachments)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", m.Title, text, strings.Join(attachments, "\x00"))
+	return db.NoticeSnapshot{
+		Hash:        hex.EncodeToString(h.Sum(nil)[:8]),
+		Title:       m.Title,
+		Text:        text,
+		Attachments: attachments,
+	}
+}
+
+// NoticeChangesMessage represents a message summarizing the changes of a modified notice since it was delivered
+type NoticeChangesMessage struct {
+	Old  db.NoticeSnapshot
+	New  db.NoticeSnapshot
+	User db.User
+}
+
+// Send sends the NoticeChangesMessage to the given recipient
+func (m *NoticeChangesMessage) Send(b *tb.Bot, to tb.Recipient, opt *tb.SendOptions) (*tb.Message, error) {
+	if opt == nil {
+		opt = &tb.SendOptions{}
+	}
+	opt.DisableWebPagePreview = true
+	return b.Send(to, m.String(), opt)
+}
+
+// noticeChangesTextDiffMaxLength is the max length of the text diff in a NoticeChangesMessage,
+// leaving enough room for the other changes in the message
+const noticeChangesTextDiffMaxLength = 3072
+
+// String formats a NoticeChangesMessage to a proper string ready to be sent by bot,
+// only the changed parts (title, attachments and text) are included
+func (m *NoticeChangesMessage) String() string {
+	l := locale.Get(m.User.LanguageCode)
+	var sb strings.Builder
+	sb.WriteString(l.NoticeUpdatedMessage)
+
+	if m.Old.Title != m.New.Title {
+		fmt.Fprintf(&sb, "\n\n%s <s>%s</s> → <b>%s</b>",
+			l.NoticeTitleChangedLabel, html.EscapeString(m.Old.Title), html.EscapeString(m.New.Title))
+	}
+
+	added, removed := diffSets(m.Old.Attachments, m.New.Attachments)
+	if len(added) > 0 {
+		fmt.Fprintf(&sb, "\n\n%s <b>%s</b>", l.NoticeAttachmentsAddedLabel, html.EscapeString(strings.Join(added, ", ")))
+	}
+	if len(removed) > 0 {
+		fmt.Fprintf(&sb, "\n\n%s <s>%s</s>", l.NoticeAttachmentsRemovedLabel, html.EscapeString(strings.Join(removed, ", ")))
+	}
+
+	if m.Old.Text != m.New.Text {
+		fmt.Fprintf(&sb, "\n\n%s\n%s", l.NoticeTextChangedLabel, diffWords(m.Old.Text, m.New.Text, noticeChangesTextDiffMaxLength))
+	}
+	return sb.String()
+}
+
 // byteCountIEC returns the human-readable file size of the given bytes count
 func byteCountIEC(b uint64) string {
 	const unit = 1024
@@ -322,6 +426,185 @@ func byteCountIEC(b uint64) string {
 	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
+// ScheduleMessage represents a message of a user's class schedule
+type ScheduleMessage struct {
+	Classes []fibapi.Class
+	User    db.User
+	Date    time.Time // if not zero, only the classes on this date will be shown
+}
+
+// Send sends a ScheduleMessage
+func (m *ScheduleMessage) Send(b *tb.Bot, to tb.Recipient, opt *tb.SendOptions) (*tb.Message, error) {
+	return b.Send(to, m.String(), tb.NoPreview)
+}
+
+// String formats a ScheduleMessage to a proper string ready to be sent by bot, with the classes grouped by day
+func (m *ScheduleMessage) String() string {
+	l := locale.Get(m.User.LanguageCode)
+	var sb strings.Builder
+
+	lastDay := time.Weekday(-1)
+	for _, c := range m.Classes {
+		day := c.Weekday()
+		if !m.Date.IsZero() && day != m.Date.Weekday() {
+			continue
+		}
+		if day != lastDay { // day header
+			if sb.Len() != 0 {
+				sb.WriteString("\n")
+			}
+			if m.Date.IsZero() {
+				fmt.Fprintf(&sb, "<b>%s</b>\n", l.WeekdayNames[day])
+			} else {
+				fmt.Fprintf(&sb, "<b>%s</b>  <i>%s</i>\n", l.WeekdayNames[day], m.Date.Format(dateLayout))
+			}
+			lastDay = day
+		}
+		sb.WriteString(formatClass(c))
+		sb.WriteString("\n")
+	}
+
+	if sb.Len() == 0 {
+		return l.NoClassesErrorMessage
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// formatClass formats a single class to a line of text, e.g., `08:00-10:00  [#IES] T 10  A5201`
+func formatClass(c fibapi.Class) string {
+	hours := c.StartTime
+	if end, err := c.End(time.Now()); err == nil {
+		hours = fmt.Sprintf("%s-%s", c.StartTime, end.Format(clockLayout))
+	}
+	line := fmt.Sprintf("<code>%s</code>  [#%s] %s %s",
+		hours,
+		strings.ReplaceAll(c.SubjectCode, "-", "_"), // telegram tags can't contain dashes
+		html.EscapeString(c.Types),
+		html.EscapeString(c.Group))
+	if c.Classrooms != "" {
+		line += "  " + html.EscapeString(c.Classrooms)
+	}
+	return line
+}
+
+// ExamsMessage represents a message of a user's upcoming exams
+type ExamsMessage struct {
+	Exams []fibapi.Exam
+	User  db.User
+}
+
+// Send sends an ExamsMessage
+func (m *ExamsMessage) Send(b *tb.Bot, to tb.Recipient, opt *tb.SendOptions) (*tb.Message, error) {
+	return b.Send(to, m.String(), tb.NoPreview)
+}
+
+// String formats an ExamsMessage to a proper string ready to be sent by bot
+func (m *ExamsMessage) String() string {
+	l := locale.Get(m.User.LanguageCode)
+	if len(m.Exams) == 0 {
+		return l.NoUpcomingExamsErrorMessage
+	}
+
+	var sb strings.Builder
+	sb.WriteString(l.ExamsMessageHeader)
+	for _, e := range m.Exams {
+		text := "\n\n" + formatExam(e, l)
+		if sb.Len()+len(text) > messageMaxLength { // omit the furthest exams if the message gets too long
+			break
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
+
+// formatExam formats a single exam to a text block, e.g., `<code>10/01/2024 08:00-11:00</code>  [#AC] Final\n📍 A5001 A5002`
+func formatExam(e fibapi.Exam, l *locale.Locale) string {
+	start := e.StartsAt.In(tzMadrid)
+	hours := start.Format(clockLayout)
+	if !e.EndsAt.IsZero() {
+		hours += "-" + e.EndsAt.In(tzMadrid).Format(clockLayout)
+	}
+	examType, ok := l.ExamTypeNames[e.Type]
+	if !ok {
+		examType = html.EscapeString(e.Type)
+	}
+
+	text := fmt.Sprintf("<code>%s %s</code>  [#%s] %s",
+		start.Format(dateLayout),
+		hours,
+		strings.ReplaceAll(e.SubjectCode, "-", "_"), // telegram tags can't contain dashes
+		examType)
+	if e.IsLab == "S" {
+		text += " (" + l.ExamLabText + ")"
+	}
+	if e.Classrooms != "" {
+		text += "\n📍 " + html.EscapeString(e.Classrooms)
+	}
+	if e.Comments != "" {
+		text += "\n<i>" + html.EscapeString(e.Comments) + "</i>"
+	}
+	return text
+}
+
+// ReminderMessage represents a message of a scheduled reminder
+type ReminderMessage struct {
+	db.Reminder
+	User db.User
+}
+
+// Send sends a ReminderMessage
+func (m *ReminderMessage) Send(b *tb.Bot, to tb.Recipient, opt *tb.SendOptions) (*tb.Message, error) {
+	return b.Send(to, m.String(), tb.NoPreview)
+}
+
+// String formats a ReminderMessage to a proper string ready to be sent by bot
+func (m *ReminderMessage) String() string {
+	l := locale.Get(m.User.LanguageCode)
+	subjectTag := strings.ReplaceAll(m.SubjectCode, "-", "_") // telegram tags can't contain dashes
+	startsAt := time.Unix(m.StartsAt, 0).In(tzMadrid)
+	classrooms := m.Classrooms
+	if classrooms == "" {
+		classrooms = "-"
+	}
+
+	switch m.Type {
+	case db.ExamReminder:
+		examType, ok := l.ExamTypeNames[m.Types]
+		if !ok {
+			examType = html.EscapeString(m.Types)
+		}
+		return fmt.Sprintf(l.ExamReminderMessage,
+			subjectTag,
+			examType,
+			startsAt.Format(dateLayout+" "+clockLayout),
+			html.EscapeString(classrooms))
+	default:
+		return fmt.Sprintf(l.ClassReminderMessage,
+			subjectTag,
+			html.EscapeString(m.Types),
+			html.EscapeString(m.Group),
+			startsAt.Format(clockLayout),
+			html.EscapeString(classrooms))
+	}
+}
+
+// ExamUpdatedMessage represents a message notifying that an exam's time or classrooms have changed
+type ExamUpdatedMessage struct {
+	fibapi.Exam
+	User db.User
+}
+
+// Send sends an ExamUpdatedMessage
+func (m *ExamUpdatedMessage) Send(b *tb.Bot, to tb.Recipient, opt *tb.SendOptions) (*tb.Message, error) {
+	return b.Send(to, m.String(), tb.NoPreview)
+}
+
+// String formats an ExamUpdatedMessage to a proper string ready to be sent by bot
+func (m *ExamUpdatedMessage) String() string {
+	l := locale.Get(m.User.LanguageCode)
+	return fmt.Sprintf("%s\n\n%s", l.ExamUpdatedMessageHeader, formatExam(m.Exam, l))
+}
+
 // ErrorMessage represents a message containing error info
 type ErrorMessage struct {
 	Text string
@@ -342,6 +625,77 @@ func (m *SilentMessage) Send(b *tb.Bot, to tb.Recipient, opt *tb.SendOptions) (*
 	return b.Send(to, m.Text, tb.NoPreview, tb.Silent)
 }
 
+// DeadLettersMessage represents a message listing the latest dead letters (notices given up on delivering) to admins
+type DeadLettersMessage struct {
+	DeadLetters []db.OutboundNotice
+	Total       int64
+}
+
+// Send sends a DeadLettersMessage
+func (m *DeadLettersMessage) Send(b *tb.Bot, to tb.Recipient, opt *tb.SendOptions) (*tb.Message, error) {
+	return b.Send(to, m.String(), tb.NoPreview)
+}
+
+// String formats a DeadLettersMessage to a proper string ready to be sent by bot
+func (m *DeadLettersMessage) String() string {
+	if m.Total == 0 {
+		return "No dead letters"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<b>%d dead letters</b>, latest %d:", m.Total, len(m.DeadLetters))
+	for _, n := range m.DeadLetters {
+		fmt.Fprintf(&sb, "\n\n<code>%s</code> (UID %d)\n%d attempts, last at %s\n<i>%s</i>",
+			n.ID, n.UserID, n.Attempts,
+			time.Unix(n.FailedAt, 0).In(tzMadrid).Format(datetimeLayout),
+			html.EscapeString(n.LastError))
+	}
+	return sb.String()
+}
+
+// StatusMessage represents a message showing whether FIB API is available to a user
+type StatusMessage struct {
+	LanguageCode string
+	Status       fibapi.BreakerStatus
+}
+
+// Send sends a StatusMessage
+func (m *StatusMessage) Send(b *tb.Bot, to tb.Recipient, opt *tb.SendOptions) (*tb.Message, error) {
+	return b.Send(to, m.String(), tb.NoPreview)
+}
+
+// String formats a StatusMessage to a proper string ready to be sent by bot
+func (m *StatusMessage) String() string {
+	l := locale.Get(m.LanguageCode)
+	if m.Status.State == fibapi.BreakerClosed {
+		return l.FIBAPIStatusUpMessage
+	}
+	return fmt.Sprintf(l.FIBAPIStatusDownMessage, m.Status.Since.In(tzMadrid).Format(datetimeLayout))
+}
+
+// FIBAPIOutageMessage represents a message notifying admins that FIB API has gone down or recovered
+type FIBAPIOutageMessage struct {
+	From, To fibapi.BreakerStatus
+}
+
+// Send sends a FIBAPIOutageMessage
+func (m *FIBAPIOutageMessage) Send(b *tb.Bot, to tb.Recipient, opt *tb.SendOptions) (*tb.Message, error) {
+	return b.Send(to, m.String(), tb.NoPreview)
+}
+
+// String formats a FIBAPIOutageMessage to a proper string ready to be sent by bot
+func (m *FIBAPIOutageMessage) String() string {
+	if m.To.State == fibapi.BreakerClosed {
+		return fmt.Sprintf("✅ <b>FIB API has recovered</b> after being down for %s",
+			m.To.Since.Sub(m.From.Since).Round(time.Second))
+	}
+	lastError := ""
+	if m.To.LastError != nil {
+		lastError = m.To.LastError.Error()
+	}
+	return fmt.Sprintf("⚠️ <b>FIB API is down</b> since %s, after %d consecutive failures\n<i>%s</i>",
+		m.To.Since.In(tzMadrid).Format(datetimeLayout), m.To.Failures, html.EscapeString(lastError))
+}
+
 // AnnouncementMessage represents an announcement message to be sent to all users
 type AnnouncementMessage struct {
 	Text string
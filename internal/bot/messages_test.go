@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
@@ -84,3 +85,75 @@ func TestNoticeMessage_String(t *testing.T) {
 		})
 	}
 }
+
+func TestScheduleMessage_String(t *testing.T) {
+	raw := `{"count": 3, "results": [{"codi_assig": "IES", "grup": "10", "dia_setmana": 1, "inici": "08:00", "durada": 2, "tipus": "T", "aules": "A5201"},{"codi_assig": "PROP", "grup": "12", "dia_setmana": 1, "inici": "12:00", "durada": 2, "tipus": "L", "aules": "A5S108"},{"codi_assig": "SO-2", "grup": "11", "dia_setmana": 3, "inici": "10:00", "durada": 1, "tipus": "P", "aules": ""}]}`
+	var resp fibapi.ScheduleResponse
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	monday := time.Date(2024, 2, 12, 9, 0, 0, 0, tzMadrid)
+	tests := []struct {
+		name         string
+		date         time.Time
+		userLangCode string
+		want         string
+	}{
+		{
+			"week",
+			time.Time{},
+			"en",
+			"<b>Monday</b>\n<code>08:00-10:00</code>  [#IES] T 10  A5201\n<code>12:00-14:00</code>  [#PROP] L 12  A5S108\n\n<b>Wednesday</b>\n<code>10:00-11:00</code>  [#SO_2] P 11",
+		},
+		{
+			"monday",
+			monday,
+			"ca",
+			"<b>Dilluns</b>  <i>12/02/2024</i>\n<code>08:00-10:00</code>  [#IES] T 10  A5201\n<code>12:00-14:00</code>  [#PROP] L 12  A5S108",
+		},
+		{
+			"tuesday",
+			monday.AddDate(0, 0, 1),
+			"es",
+			"<i>No hay clases.</i>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &ScheduleMessage{
+				Classes: resp.Results,
+				User:    db.User{LanguageCode: tt.userLangCode},
+				Date:    tt.date,
+			}
+			if gotResult := m.String(); gotResult != tt.want {
+				t.Error(cmp.Diff(tt.want, gotResult))
+			}
+		})
+	}
+}
+
+func TestExamsMessage_String(t *testing.T) {
+	raw := `{"count": 3, "next": null, "previous": null, "results": [{"id": 29227, "assig": "PROP", "aules": "A5001 A5002", "inici": "2024-01-12T15:00:00", "fi": "2024-01-12T18:00:00", "quatr": 1, "curs": 2023, "pla": "GRAU", "tipus": "F", "comentaris": "", "eslaboratori": "N"},{"id": 29226, "assig": "IES", "aules": "A6103", "inici": "2024-01-10T08:00:00", "fi": "2024-01-10T10:00:00", "quatr": 1, "curs": 2023, "pla": "GRAU", "tipus": "P", "comentaris": "Portar calculadora", "eslaboratori": "S"},{"id": 29225, "assig": "AC", "aules": "A5101", "inici": "2024-01-09T08:00:00", "fi": "2024-01-09T11:00:00", "quatr": 1, "curs": 2023, "pla": "GRAU", "tipus": "F", "comentaris": "", "eslaboratori": "N"}]}`
+	var resp fibapi.PublicExamsResponse
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		t.Fatal(err)
+	}
+	subjects := []fibapi.Subject{{ID: "IES"}, {ID: "PROP"}}
+	now := time.Date(2024, 1, 8, 12, 0, 0, 0, tzMadrid)
+
+	m := &ExamsMessage{
+		Exams: FilterUpcomingExams(resp.Results, subjects, now),
+		User:  db.User{LanguageCode: "en"},
+	}
+	want := "<b>📝 Upcoming exams</b>\n\n<code>10/01/2024 08:00-10:00</code>  [#IES] Midterm (lab)\n📍 A6103\n<i>Portar calculadora</i>\n\n<code>12/01/2024 15:00-18:00</code>  [#PROP] Final\n📍 A5001 A5002"
+	if gotResult := m.String(); gotResult != want {
+		t.Error(cmp.Diff(want, gotResult))
+	}
+
+	m.Exams = FilterUpcomingExams(resp.Results, subjects, now.AddDate(0, 1, 0))
+	if gotResult := m.String(); gotResult != "<i>No upcoming exams.</i>" {
+		t.Errorf("unexpected message for no exams: %s", gotResult)
+	}
+}
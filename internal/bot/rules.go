@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"RacoBot/internal/db"
+	"RacoBot/pkg/fibapi"
+)
+
+// limits of alert rules
+const (
+	maxAlertRules             = db.MaxAlertRules
+	maxAlertRulePatternLength = 100
+	maxAlertRulePrefixLength  = 16
+)
+
+// errors
+var (
+	ErrInvalidAlertRule        = errors.New("invalid alert rule")
+	ErrAlertRulePatternTooLong = errors.New("alert rule pattern too long")
+	ErrAlertRulePrefixTooLong  = errors.New("alert rule prefix too long")
+)
+
+var (
+	// alertRuleRegex matches an alert rule in command payloads, e.g., `/examen|exam/i loud pin prefix ⚠️`
+	alertRuleRegex = regexp.MustCompile(`^/(.+?)/(i?)(?:\s+(.*))?$`)
+	htmlTagRegex   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ParseAlertRule parses an alert rule in the format of `/<pattern>/[i] [loud] [pin] [prefix <text>]`,
+// at least one action must be given, and the pattern must be a valid regular expression
+func ParseAlertRule(s string) (db.AlertRule, error) {
+	m := alertRuleRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return db.AlertRule{}, ErrInvalidAlertRule
+	}
+	rule := db.AlertRule{
+		Pattern:         m[1],
+		CaseInsensitive: m[2] == "i",
+	}
+	if len(rule.Pattern) > maxAlertRulePatternLength {
+		return db.AlertRule{}, ErrAlertRulePatternTooLong
+	}
+	if _, err := compileAlertRule(rule); err != nil {
+		return db.AlertRule{}, err
+	}
+
+	actions := strings.Fields(m[3])
+	for i := 0; i < len(actions); i++ {
+		switch strings.ToLower(actions[i]) {
+		case "loud":
+			rule.Loud = true
+		case "pin":
+			rule.Pin = true
+		case "prefix": // takes the rest as the prefix text
+			rule.Prefix = strings.Join(actions[i+1:], " ")
+			if rule.Prefix == "" {
+				return db.AlertRule{}, ErrInvalidAlertRule
+			}
+			if len([]rune(rule.Prefix)) > maxAlertRulePrefixLength {
+				return db.AlertRule{}, ErrAlertRulePrefixTooLong
+			}
+			i = len(actions)
+		default:
+			return db.AlertRule{}, ErrInvalidAlertRule
+		}
+	}
+	if !rule.Loud && !rule.Pin && rule.Prefix == "" {
+		return db.AlertRule{}, ErrInvalidAlertRule
+	}
+	return rule, nil
+}
+
+// compileAlertRule compiles the pattern of the given alert rule
+func compileAlertRule(r db.AlertRule) (*regexp.Regexp, error) {
+	pattern := r.Pattern
+	if r.CaseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// formatAlertRule formats an alert rule back to the format it's added with
+func formatAlertRule(r db.AlertRule) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "/%s/", r.Pattern)
+	if r.CaseInsensitive {
+		sb.WriteString("i")
+	}
+	if r.Loud {
+		sb.WriteString(" loud")
+	}
+	if r.Pin {
+		sb.WriteString(" pin")
+	}
+	if r.Prefix != "" {
+		sb.WriteString(" prefix ")
+		sb.WriteString(r.Prefix)
+	}
+	return html.EscapeString(sb.String())
+}
+
+// AlertActions represents the combined actions of all alert rules matching a notice
+type AlertActions struct {
+	Loud   bool
+	Pin    bool
+	Prefix string
+}
+
+// MatchAlertRules matches the given notice's title and text (without HTML tags) against the given alert rules,
+// and returns the combined actions of all matching rules, prefixes are joined in the rules' order
+func MatchAlertRules(rules []db.AlertRule, n fibapi.Notice) (actions AlertActions) {
+	if len(rules) == 0 {
+		return
+	}
+	text := n.Title + "\n" + html.UnescapeString(htmlTagRegex.ReplaceAllString(n.Text, " "))
+
+	var prefixes []string
+	for _, r := range rules {
+		re, err := compileAlertRule(r)
+		if err != nil { // shouldn't happen since they're validated when added
+			log.Errorf("failed to compile alert rule %q: %v", r.Pattern, err)
+			continue
+		}
+		if !re.MatchString(text) {
+			continue
+		}
+		actions.Loud = actions.Loud || r.Loud
+		actions.Pin = actions.Pin || r.Pin
+		if r.Prefix != "" {
+			prefixes = append(prefixes, r.Prefix)
+		}
+	}
+	actions.Prefix = strings.Join(prefixes, " ")
+	return
+}
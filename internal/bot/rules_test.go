@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"RacoBot/internal/db"
+	"RacoBot/pkg/fibapi"
+)
+
+func TestParseAlertRule(t *testing.T) {
+	type test struct {
+		payload string
+		want    db.AlertRule
+		wantErr error
+	}
+	tests := []test{
+		{
+			"/examen|exam/i loud pin",
+			db.AlertRule{Pattern: "examen|exam", CaseInsensitive: true, Loud: true, Pin: true},
+			nil,
+		},
+		{
+			"/canvi d'aula/ prefix ⚠️",
+			db.AlertRule{Pattern: "canvi d'aula", Prefix: "⚠️"},
+			nil,
+		},
+		{
+			"/a/b/ prefix [IMPORTANT] !",
+			db.AlertRule{Pattern: "a/b", Prefix: "[IMPORTANT] !"},
+			nil,
+		},
+		{"/examen/i", db.AlertRule{}, ErrInvalidAlertRule},
+		{"examen loud", db.AlertRule{}, ErrInvalidAlertRule},
+		{"/examen/ loud shout", db.AlertRule{}, ErrInvalidAlertRule},
+		{"/examen/ prefix", db.AlertRule{}, ErrInvalidAlertRule},
+		{"/examen/ prefix this prefix is way too long", db.AlertRule{}, ErrAlertRulePrefixTooLong},
+	}
+
+	for _, tc := range tests {
+		got, err := ParseAlertRule(tc.payload)
+		if err != tc.wantErr {
+			t.Errorf("%q: got error %v, want %v", tc.payload, err, tc.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%q: mismatch (-want +got):\n%s", tc.payload, diff)
+		}
+	}
+
+	if _, err := ParseAlertRule("/exa(men/ loud"); err == nil {
+		t.Error("invalid regular expression: got no error")
+	}
+}
+
+func TestMatchAlertRules(t *testing.T) {
+	rules := []db.AlertRule{
+		{Pattern: "examen|exam", CaseInsensitive: true, Loud: true, Pin: true},
+		{Pattern: "canvi d'aula", Prefix: "⚠️"},
+		{Pattern: "aula", Prefix: "🏫"},
+	}
+	type test struct {
+		notice fibapi.Notice
+		want   AlertActions
+	}
+	tests := []test{
+		{
+			fibapi.Notice{Title: "Data de l'EXAMEN parcial", Text: "<p>Hola</p>"},
+			AlertActions{Loud: true, Pin: true},
+		},
+		{
+			fibapi.Notice{Title: "Avís", Text: "<p>Hi ha un <b>canvi d'aula</b> per dimarts</p>"},
+			AlertActions{Prefix: "⚠️ 🏫"},
+		},
+		{
+			fibapi.Notice{Title: "Avís", Text: "<p>canvi d&#39;aula</p>"},
+			AlertActions{Prefix: "⚠️ 🏫"},
+		},
+		{
+			fibapi.Notice{Title: "Inici del curs", Text: "<p>Benvinguts</p>"},
+			AlertActions{},
+		},
+	}
+
+	for _, tc := range tests {
+		got := MatchAlertRules(rules, tc.notice)
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%q: mismatch (-want +got):\n%s", tc.notice.Title, diff)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -16,12 +17,32 @@ import (
 // key names
 const (
 	keySubjectCodes = "subject_codes"
+	keyUsers        = "users"          // sorted set of user IDs scored by their signup timestamps
+	keyReminders    = "reminders"      // sorted set of reminder IDs scored by their due timestamps
+	keyReminderData = "reminders_data" // hash of reminder IDs to their data
+	keyOutbox       = "outbox"         // sorted set of outbound notice IDs scored by their next attempt timestamps
+	keyOutboxData   = "outbox_data"    // hash of outbound notice IDs to their data
+	keyDeadLetters  = "dead_letters"   // list of outbound notices which have been given up on, newest first
 )
 
+// keySchemaVersion is the key of the schema version of stored records, see Migrate
+const keySchemaVersion = "schema_version"
+
+// keyPrefixMeta prefixes the keys of metadata of the stored records other than the schema version, see GetMeta
+const keyPrefixMeta = "meta"
+
 // key name prefixes
 const (
-	keyPrefixLoginSession = "l"
-	keyPrefixUser         = "u"
+	keyPrefixLoginSession  = "l"
+	keyPrefixUser          = "u"
+	keyPrefixCalendarToken = "c"
+	keyPrefixKnownExams    = "e"
+	keyPrefixAlertRules    = "a"
+	keyPrefixDelivered     = "d"
+	keyPrefixValidators    = "v"
+	keyPrefixSnapshot      = "s" // keys of `s:noticeID:hash`
+	keyPrefixLease         = "lease"
+	keyPrefixLeaseTerm     = "lease_term" // the fencing token of the current term of a lease, see Fence
 )
 
 // key expirations
@@ -29,12 +50,26 @@ const (
 	ttlLoginSession = 10 * time.Minute     // 10 minutes
 	ttlUser         = 0 * time.Second      // no expiration
 	ttlSubjectCode  = time.Hour * 24 * 150 // 150 days
+	ttlValidators   = time.Hour * 24 * 7   // 7 days, it's only a cache
+	ttlSnapshot     = time.Hour * 24 * 7   // 7 days after the notice expires, see noticeSnapshotTTL
 )
 
+// noticeSnapshotTTL returns the TTL of a snapshot of a notice with the given expiration timestamp,
+// it outlives the notice for a while since the users' delivered notices are only forgotten when they next poll
+func noticeSnapshotTTL(expiresAt int64) time.Duration {
+	ttl := time.Until(time.Unix(expiresAt, 0))
+	if ttl < 0 {
+		ttl = 0
+	}
+	return ttl + ttlSnapshot
+}
+
 const (
 	oauthStateLength           = 15                   // no padding
 	OAuthStateHexEncodedLength = 2 * oauthStateLength // for use in HTTP handler check
 	//OAuthStateBase64EncodedLength = ((4 * oauthStateLength / 3) + 3) & ^3 // for use in HTTP handler check
+	calendarTokenLength           = 20
+	CalendarTokenHexEncodedLength = 2 * calendarTokenLength // for use in HTTP handler check
 )
 
 // NewLoginSession creates a login session for a user with the given ID and language code
@@ -53,9 +88,9 @@ func NewLoginSession(userID int64, languageCode string) (LoginSession, error) {
 }
 
 // GetLoginSession gets a login session with the given state
-func GetLoginSession(state string) (LoginSession, error) {
+func (rs *redisStore) GetLoginSession(state string) (LoginSession, error) {
 	key := fmt.Sprintf("%s:%s", keyPrefixLoginSession, state)
-	value, err := rdb.Get(ctx, key).Result()
+	value, err := rs.rdb.Get(ctx, key).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			err = ErrLoginSessionNotFound
@@ -72,25 +107,25 @@ func GetLoginSession(state string) (LoginSession, error) {
 }
 
 // PutLoginSession puts the given login session
-func PutLoginSession(s LoginSession) error {
+func (rs *redisStore) PutLoginSession(s LoginSession) error {
 	key := fmt.Sprintf("%s:%s", keyPrefixLoginSession, s.State)
 	value, err := json.Marshal(s)
 	if err != nil {
 		return err
 	}
-	return rdb.Set(ctx, key, value, ttlLoginSession).Err()
+	return rs.rdb.Set(ctx, key, value, ttlLoginSession).Err()
 }
 
 // DelLoginSession deletes a login session with the given state
-func DelLoginSession(state string) error {
+func (rs *redisStore) DelLoginSession(state string) error {
 	key := fmt.Sprintf("%s:%s", keyPrefixLoginSession, state)
-	return rdb.Del(ctx, key).Err()
+	return rs.rdb.Del(ctx, key).Err()
 }
 
 // GetUser gets a user with the given ID
-func GetUser(userID int64) (User, error) {
+func (rs *redisStore) GetUser(userID int64) (User, error) {
 	key := fmt.Sprintf("%s:%d", keyPrefixUser, userID)
-	value, err := rdb.Get(ctx, key).Result()
+	value, err := rs.rdb.Get(ctx, key).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			err = ErrUserNotFound
@@ -107,47 +142,419 @@ func GetUser(userID int64) (User, error) {
 }
 
 // PutUser puts the given user
-func PutUser(user User) error {
+func (rs *redisStore) PutUser(user User) error {
 	key := fmt.Sprintf("%s:%d", keyPrefixUser, user.ID)
 	value, err := json.Marshal(user)
 	if err != nil {
 		return err
 	}
-	return rdb.Set(ctx, key, value, ttlUser).Err()
+	_, err = rs.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, value, ttlUser)
+		pipe.ZAddNX(ctx, keyUsers, redis.Z{Score: float64(time.Now().Unix()), Member: user.ID})
+		return nil
+	})
+	return err
 }
 
-// DelUser deletes a user with the given ID
-// TODO: add userIDs to a set?
-func DelUser(userID int64) error {
-	key := fmt.Sprintf("%s:%d", keyPrefixUser, userID)
-	return rdb.Del(ctx, key).Err()
+// CompareAndPutUser puts the given user only if their stored record is still the given old one,
+// returning whether it has been put, i.e., false if it has been changed (or deleted) since it was got
+func (rs *redisStore) CompareAndPutUser(old, user User) (bool, error) {
+	key := fmt.Sprintf("%s:%d", keyPrefixUser, user.ID)
+	value, err := json.Marshal(user)
+	if err != nil {
+		return false, err
+	}
+	err = rs.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, key).Bytes()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return redis.TxFailedErr
+			}
+			return err
+		}
+		var u User
+		if err = json.Unmarshal(current, &u); err != nil {
+			return err
+		}
+		u.ID = user.ID
+		if !reflect.DeepEqual(u, old) {
+			return redis.TxFailedErr
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, value, ttlUser)
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) { // changed meanwhile
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DelUser deletes a user with the given ID, along with their calendar token, known exams, alert rules and delivered notices
+func (rs *redisStore) DelUser(userID int64) error {
+	user, err := rs.GetUser(userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	keys := []string{
+		fmt.Sprintf("%s:%d", keyPrefixUser, userID),
+		fmt.Sprintf("%s:%d", keyPrefixKnownExams, userID),
+		fmt.Sprintf("%s:%d", keyPrefixAlertRules, userID),
+		fmt.Sprintf("%s:%d", keyPrefixDelivered, userID),
+		fmt.Sprintf("%s:%d", keyPrefixValidators, userID),
+	}
+	if user.CalendarToken != "" {
+		keys = append(keys, fmt.Sprintf("%s:%s", keyPrefixCalendarToken, user.CalendarToken))
+	}
+	_, err = rs.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		pipe.ZRem(ctx, keyUsers, userID)
+		return nil
+	})
+	return err
+}
+
+// ScanUserIDs gets a page of about `count` user IDs from the user index starting at the given cursor ("" for the first page),
+// along with the cursor of the next page ("" if it's the last one)
+func (rs *redisStore) ScanUserIDs(cursor string, count int64) ([]int64, string, error) {
+	var c uint64
+	if cursor != "" {
+		var err error
+		if c, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", err
+		}
+	}
+	values, next, err := rs.rdb.ZScan(ctx, keyUsers, c, "", count).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	userIDs := make([]int64, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 { // members and their scores
+		ID, err := strconv.ParseInt(values[i], 10, 64)
+		if err != nil {
+			return nil, "", err
+		}
+		userIDs = append(userIDs, ID)
+	}
+	if next == 0 {
+		return userIDs, "", nil
+	}
+	return userIDs, strconv.FormatUint(next, 10), nil
+}
+
+// indexUsers builds the user index from the existing user keys, for DBs created before the index was introduced,
+// users already indexed are left untouched, and the users found are scored 0 as their signup times are unknown
+// it returns the number of users (which would be) indexed
+func (rs *redisStore) indexUsers(dryRun bool) (int, error) {
+	count := 0
+	iter := rs.rdb.Scan(ctx, 0, fmt.Sprintf("%s:*", keyPrefixUser), 1000).Iterator()
+	for iter.Next(ctx) {
+		ID, err := strconv.ParseInt(strings.TrimPrefix(iter.Val(), keyPrefixUser+":"), 10, 64)
+		if err != nil {
+			return count, err
+		}
+		if dryRun {
+			if err = rs.rdb.ZScore(ctx, keyUsers, strconv.FormatInt(ID, 10)).Err(); errors.Is(err, redis.Nil) {
+				count++
+			} else if err != nil {
+				return count, err
+			}
+			continue
+		}
+		added, err := rs.rdb.ZAddNX(ctx, keyUsers, redis.Z{Score: 0, Member: ID}).Result()
+		if err != nil {
+			return count, err
+		}
+		count += int(added)
+	}
+	return count, iter.Err()
+}
+
+// GetSchemaVersion gets the schema version of the stored records, 0 if it has never been set
+func (rs *redisStore) GetSchemaVersion() (int, error) {
+	version, err := rs.rdb.Get(ctx, keySchemaVersion).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return version, err
+}
+
+// PutSchemaVersion puts the schema version of the stored records
+func (rs *redisStore) PutSchemaVersion(version int) error {
+	return rs.rdb.Set(ctx, keySchemaVersion, version, 0).Err()
+}
+
+// GetMeta gets the metadata value with the given name, empty if it has never been set
+func (rs *redisStore) GetMeta(name string) (string, error) {
+	value, err := rs.rdb.Get(ctx, keyPrefixMeta+":"+name).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return value, err
+}
+
+// PutMeta puts the metadata value with the given name
+func (rs *redisStore) PutMeta(name, value string) error {
+	return rs.rdb.Set(ctx, keyPrefixMeta+":"+name, value, 0).Err()
+}
+
+// RotateCalendarToken generates a new calendar feed token for the given user and puts the user,
+// the user's previous token (if any) is revoked
+func RotateCalendarToken(user *User) error {
+	buf := make([]byte, calendarTokenLength)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	oldToken := user.CalendarToken
+	user.CalendarToken = hex.EncodeToString(buf)
+	encrypted, err := encryptUserTokens(*user)
+	if err != nil {
+		return err
+	}
+	return store.ReplaceCalendarToken(encrypted, oldToken)
+}
+
+// ReplaceCalendarToken puts the given user along with their calendar feed token, revoking the given old one (if any)
+func (rs *redisStore) ReplaceCalendarToken(user User, oldToken string) error {
+	userKey := fmt.Sprintf("%s:%d", keyPrefixUser, user.ID)
+	userValue, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	_, err = rs.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if oldToken != "" {
+			pipe.Del(ctx, fmt.Sprintf("%s:%s", keyPrefixCalendarToken, oldToken))
+		}
+		pipe.Set(ctx, fmt.Sprintf("%s:%s", keyPrefixCalendarToken, user.CalendarToken), user.ID, ttlUser)
+		pipe.Set(ctx, userKey, userValue, ttlUser)
+		pipe.ZAddNX(ctx, keyUsers, redis.Z{Score: float64(time.Now().Unix()), Member: user.ID})
+		return nil
+	})
+	return err
+}
+
+// GetCalendarTokenUserID gets the ID of the user who owns the given calendar feed token
+func (rs *redisStore) GetCalendarTokenUserID(token string) (int64, error) {
+	key := fmt.Sprintf("%s:%s", keyPrefixCalendarToken, token)
+	userID, err := rs.rdb.Get(ctx, key).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			err = ErrCalendarTokenNotFound
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// GetKnownExams gets the last known states of the exams of a user with the given ID, by exam ID
+func (rs *redisStore) GetKnownExams(userID int64) (map[int32]KnownExam, error) {
+	key := fmt.Sprintf("%s:%d", keyPrefixKnownExams, userID)
+	values, err := rs.rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	exams := make(map[int32]KnownExam, len(values))
+	for field, value := range values {
+		ID, err := strconv.ParseInt(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		var e KnownExam
+		if err = json.Unmarshal([]byte(value), &e); err != nil {
+			return nil, err
+		}
+		exams[int32(ID)] = e
+	}
+	return exams, nil
+}
+
+// PutKnownExams replaces the last known states of the exams of a user with the given ID
+func (rs *redisStore) PutKnownExams(userID int64, exams map[int32]KnownExam) error {
+	key := fmt.Sprintf("%s:%d", keyPrefixKnownExams, userID)
+	values := make(map[string]interface{}, len(exams))
+	for ID, e := range exams {
+		value, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		values[strconv.FormatInt(int64(ID), 10)] = value
+	}
+
+	_, err := rs.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(values) > 0 {
+			pipe.HSet(ctx, key, values)
+		}
+		return nil
+	})
+	return err
+}
+
+// GetAlertRules gets the alert rules of a user with the given ID
+func (rs *redisStore) GetAlertRules(userID int64) ([]AlertRule, error) {
+	key := fmt.Sprintf("%s:%d", keyPrefixAlertRules, userID)
+	value, err := rs.rdb.Get(ctx, key).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			err = nil
+		}
+		return nil, err
+	}
+
+	var rules []AlertRule
+	if err = json.Unmarshal([]byte(value), &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
 }
 
-// GetAllUserIDs gets all user IDs
-// TODO: get userIDs from a set?
-func GetAllUserIDs() ([]int64, error) {
-	keys, err := rdb.Keys(ctx, fmt.Sprintf("%s:*", keyPrefixUser)).Result()
+// PutAlertRules replaces the alert rules of a user with the given ID
+func (rs *redisStore) PutAlertRules(userID int64, rules []AlertRule) error {
+	key := fmt.Sprintf("%s:%d", keyPrefixAlertRules, userID)
+	if len(rules) == 0 {
+		return rs.rdb.Del(ctx, key).Err()
+	}
+	value, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	return rs.rdb.Set(ctx, key, value, ttlUser).Err()
+}
+
+// GetNoticesValidators gets the validators of the last fetched notices of a user with the given ID,
+// zero if there are none
+func (rs *redisStore) GetNoticesValidators(userID int64) (NoticesValidators, error) {
+	key := fmt.Sprintf("%s:%d", keyPrefixValidators, userID)
+	value, err := rs.rdb.Get(ctx, key).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			err = nil
 		}
+		return NoticesValidators{}, err
+	}
+
+	var v NoticesValidators
+	if err = json.Unmarshal([]byte(value), &v); err != nil {
+		return NoticesValidators{}, err
+	}
+	return v, nil
+}
+
+// PutNoticesValidators replaces the validators of the last fetched notices of a user with the given ID
+func (rs *redisStore) PutNoticesValidators(userID int64, v NoticesValidators) error {
+	key := fmt.Sprintf("%s:%d", keyPrefixValidators, userID)
+	if v == (NoticesValidators{}) {
+		return rs.rdb.Del(ctx, key).Err()
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return rs.rdb.Set(ctx, key, value, ttlValidators).Err()
+}
+
+// GetDeliveredNotices gets the notices delivered to a user with the given ID, by notice ID
+func (rs *redisStore) GetDeliveredNotices(userID int64) (map[int32]DeliveredNotice, error) {
+	key := fmt.Sprintf("%s:%d", keyPrefixDelivered, userID)
+	values, err := rs.rdb.HGetAll(ctx, key).Result()
+	if err != nil {
 		return nil, err
 	}
 
-	userIDs := make([]int64, 0, len(keys))
-	for _, key := range keys {
-		ID, err := strconv.ParseInt(strings.TrimPrefix(key, keyPrefixUser+":"), 10, 64)
+	notices := make(map[int32]DeliveredNotice, len(values))
+	for field, value := range values {
+		ID, err := strconv.ParseInt(field, 10, 32)
 		if err != nil {
 			return nil, err
 		}
-		userIDs = append(userIDs, ID)
+		var n DeliveredNotice
+		if err = json.Unmarshal([]byte(value), &n); err != nil {
+			return nil, err
+		}
+		notices[int32(ID)] = n
 	}
-	return userIDs, nil
+	return notices, nil
+}
+
+// PutDeliveredNotice puts the given delivered notice with the given ID of a user with the given ID
+func (rs *redisStore) PutDeliveredNotice(userID int64, noticeID int32, n DeliveredNotice) error {
+	key := fmt.Sprintf("%s:%d", keyPrefixDelivered, userID)
+	value, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return rs.rdb.HSet(ctx, key, strconv.FormatInt(int64(noticeID), 10), value).Err()
+}
+
+// PutDeliveredNotices puts the given delivered notices (by notice ID) of a user with the given ID in bulk
+func (rs *redisStore) PutDeliveredNotices(userID int64, notices map[int32]DeliveredNotice) error {
+	if len(notices) == 0 {
+		return nil
+	}
+	key := fmt.Sprintf("%s:%d", keyPrefixDelivered, userID)
+	values := make(map[string]interface{}, len(notices))
+	for ID, n := range notices {
+		value, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		values[strconv.FormatInt(int64(ID), 10)] = value
+	}
+	return rs.rdb.HSet(ctx, key, values).Err()
+}
+
+// DelDeliveredNotices deletes the delivered notices with the given IDs of a user with the given ID
+func (rs *redisStore) DelDeliveredNotices(userID int64, noticeIDs ...int32) error {
+	if len(noticeIDs) == 0 {
+		return nil
+	}
+	key := fmt.Sprintf("%s:%d", keyPrefixDelivered, userID)
+	fields := make([]string, 0, len(noticeIDs))
+	for _, ID := range noticeIDs {
+		fields = append(fields, strconv.FormatInt(int64(ID), 10))
+	}
+	return rs.rdb.HDel(ctx, key, fields...).Err()
+}
+
+// GetNoticeSnapshot gets the snapshot with the given hash of a notice with the given ID
+func (rs *redisStore) GetNoticeSnapshot(noticeID int32, hash string) (NoticeSnapshot, error) {
+	key := fmt.Sprintf("%s:%d:%s", keyPrefixSnapshot, noticeID, hash)
+	value, err := rs.rdb.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return NoticeSnapshot{}, ErrNoticeSnapshotNotFound
+		}
+		return NoticeSnapshot{}, err
+	}
+	s := NoticeSnapshot{Hash: hash}
+	if err = json.Unmarshal(value, &s); err != nil {
+		return NoticeSnapshot{}, err
+	}
+	return s, nil
+}
+
+// PutNoticeSnapshot puts the given snapshot of a notice with the given ID,
+// which is kept until a while after the notice's expiration timestamp
+func (rs *redisStore) PutNoticeSnapshot(noticeID int32, s NoticeSnapshot, expiresAt int64) error {
+	key := fmt.Sprintf("%s:%d:%s", keyPrefixSnapshot, noticeID, s.Hash)
+	value, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return rs.rdb.Set(ctx, key, value, noticeSnapshotTTL(expiresAt)).Err()
 }
 
 // GetSubjectUPCCode gets the UPC code of a subject with the given acronym
-func GetSubjectUPCCode(acronym string) (uint32, error) {
-	value, err := rdb.HGet(ctx, keySubjectCodes, acronym).Result()
+func (rs *redisStore) GetSubjectUPCCode(acronym string) (uint32, error) {
+	value, err := rs.rdb.HGet(ctx, keySubjectCodes, acronym).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			err = ErrSubjectNotFound
@@ -162,25 +569,43 @@ func GetSubjectUPCCode(acronym string) (uint32, error) {
 	return uint32(i), nil
 }
 
+// GetAllSubjectUPCCodes gets the UPC codes of all subjects, by their acronyms
+func (rs *redisStore) GetAllSubjectUPCCodes() (map[string]uint32, error) {
+	values, err := rs.rdb.HGetAll(ctx, keySubjectCodes).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make(map[string]uint32, len(values))
+	for acronym, value := range values {
+		i, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		codes[acronym] = uint32(i)
+	}
+	return codes, nil
+}
+
 // PutSubjectUPCCode puts the given UPC code of a subject with the given acronym
-func PutSubjectUPCCode(acronym string, code uint32) error {
+func (rs *redisStore) PutSubjectUPCCode(acronym string, code uint32) error {
 	value := strconv.FormatUint(uint64(code), 10)
-	return rdb.HSet(ctx, keySubjectCodes, acronym, value).Err()
+	return rs.rdb.HSet(ctx, keySubjectCodes, acronym, value).Err()
 }
 
 // PutSubjectUPCCodes puts the given subject UPC codes in bulk
-func PutSubjectUPCCodes(codes map[string]uint32) error {
+func (rs *redisStore) PutSubjectUPCCodes(codes map[string]uint32) error {
 	values := make(map[string]interface{}, len(codes))
 	for acronym, code := range codes {
 		values[acronym] = strconv.FormatUint(uint64(code), 10)
 	}
-	if err := rdb.HSet(ctx, keySubjectCodes, values).Err(); err != nil {
+	if err := rs.rdb.HSet(ctx, keySubjectCodes, values).Err(); err != nil {
 		return err
 	}
-	return rdb.Expire(ctx, keySubjectCodes, ttlSubjectCode).Err()
+	return rs.rdb.Expire(ctx, keySubjectCodes, ttlSubjectCode).Err()
 }
 
 // DelAllSubjectUPCCodes deletes all subject UPC codes
-func DelAllSubjectUPCCodes() error {
-	return rdb.Del(ctx, keySubjectCodes).Err()
+func (rs *redisStore) DelAllSubjectUPCCodes() error {
+	return rs.rdb.Del(ctx, keySubjectCodes).Err()
 }
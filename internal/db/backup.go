@@ -0,0 +1,283 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// archiveFormatVersion is the version of the backup archive format, bump it on incompatible changes
+const archiveFormatVersion = 1
+
+// errors
+var (
+	ErrArchiveEncrypted    = errors.New("db: archive is encrypted but no key is given")
+	ErrUnsupportedArchive  = errors.New("db: unsupported archive format version")
+	ErrArchiveSchemaTooNew = errors.New("db: archive schema version is newer than the supported one")
+)
+
+// archive represents a backup archive of the bot's data, which is optionally encrypted as a whole
+// if encrypted, `Data` holds the AES-GCM sealed (nonce prepended) JSON of the archive with the data
+type archive struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	Encrypted     bool      `json:"encrypted,omitempty"`
+	Data          []byte    `json:"data,omitempty"`
+
+	SchemaVersion int               `json:"schema_version,omitempty"`
+	Users         []archivedUser    `json:"users,omitempty"`
+	SubjectCodes  map[string]uint32 `json:"subject_codes,omitempty"`
+}
+
+// archivedUser represents a user along with all their data in a backup archive, OAuth tokens are in plaintext
+type archivedUser struct {
+	ID               int64                     `json:"id"`
+	User             User                      `json:"user"`
+	AlertRules       []AlertRule               `json:"alert_rules,omitempty"`
+	KnownExams       map[int32]KnownExam       `json:"known_exams,omitempty"`
+	DeliveredNotices map[int32]DeliveredNotice `json:"delivered_notices,omitempty"`
+}
+
+// newArchiveCipher makes the AES-GCM cipher of archives with the given 32-byte key
+func newArchiveCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != encryptionKeyLength {
+		return nil, fmt.Errorf("archive key must be %d bytes long", encryptionKeyLength)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Backup writes an archive of all users (along with their preferences and states) and cached subject codes
+// to the given writer, encrypted with the given key if it's not nil
+// it returns the number of users backed up
+func Backup(w io.Writer, key []byte) (int, error) {
+	a := archive{
+		FormatVersion: archiveFormatVersion,
+		CreatedAt:     time.Now(),
+	}
+	var err error
+	if a.SchemaVersion, err = store.GetSchemaVersion(); err != nil {
+		return 0, err
+	}
+	if a.SubjectCodes, err = store.GetAllSubjectUPCCodes(); err != nil {
+		return 0, err
+	}
+
+	users := NewUserIDIterator()
+	for users.Next() {
+		u := archivedUser{ID: users.UserID()}
+		if u.User, err = GetUser(u.ID); err != nil {
+			if errors.Is(err, ErrUserNotFound) { // deleted meanwhile
+				continue
+			}
+			return 0, err
+		}
+		if u.AlertRules, err = store.GetAlertRules(u.ID); err != nil {
+			return 0, err
+		}
+		if u.KnownExams, err = store.GetKnownExams(u.ID); err != nil {
+			return 0, err
+		}
+		if u.DeliveredNotices, err = store.GetDeliveredNotices(u.ID); err != nil {
+			return 0, err
+		}
+		a.Users = append(a.Users, u)
+	}
+	if err = users.Err(); err != nil {
+		return 0, err
+	}
+	count := len(a.Users)
+
+	if key != nil {
+		aead, err := newArchiveCipher(key)
+		if err != nil {
+			return 0, err
+		}
+		plaintext, err := json.Marshal(a)
+		if err != nil {
+			return 0, err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err = rand.Read(nonce); err != nil {
+			return 0, err
+		}
+		a = archive{
+			FormatVersion: archiveFormatVersion,
+			CreatedAt:     a.CreatedAt,
+			Encrypted:     true,
+			Data:          aead.Seal(nonce, nonce, plaintext, nil),
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return count, enc.Encode(a)
+}
+
+// Restore reads an archive written by Backup from the given reader, decrypted with the given key if it's encrypted,
+// and imports its data. Users already in the store are merged rather than overwritten: their records and preferences
+// are kept (except for OAuth tokens, which are taken from the archive if they expire later), and only their alert rules,
+// known exams and delivered notices absent in the store are added
+// it returns the numbers of users added and merged
+func Restore(r io.Reader, key []byte) (added, merged int, err error) {
+	var a archive
+	if err = json.NewDecoder(r).Decode(&a); err != nil {
+		return 0, 0, err
+	}
+	if a.FormatVersion != archiveFormatVersion {
+		return 0, 0, fmt.Errorf("%w: %d", ErrUnsupportedArchive, a.FormatVersion)
+	}
+	if a.Encrypted {
+		if key == nil {
+			return 0, 0, ErrArchiveEncrypted
+		}
+		aead, err := newArchiveCipher(key)
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(a.Data) < aead.NonceSize() {
+			return 0, 0, errMalformedCiphertext
+		}
+		plaintext, err := aead.Open(nil, a.Data[:aead.NonceSize()], a.Data[aead.NonceSize():], nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		a = archive{}
+		if err = json.Unmarshal(plaintext, &a); err != nil {
+			return 0, 0, err
+		}
+	}
+	if a.SchemaVersion > SchemaVersion {
+		return 0, 0, fmt.Errorf("%w: %d", ErrArchiveSchemaTooNew, a.SchemaVersion)
+	}
+
+	if len(a.SubjectCodes) > 0 {
+		if err = store.PutSubjectUPCCodes(a.SubjectCodes); err != nil {
+			return added, merged, err
+		}
+	}
+	for _, u := range a.Users {
+		u.User.ID = u.ID
+		existing, err := GetUser(u.ID)
+		if err != nil && !errors.Is(err, ErrUserNotFound) {
+			return added, merged, err
+		}
+		if err == nil {
+			if err = mergeUser(existing, u); err != nil {
+				return added, merged, fmt.Errorf("user %d: %w", u.ID, err)
+			}
+			merged++
+			continue
+		}
+
+		if err = restoreUser(u); err != nil {
+			return added, merged, fmt.Errorf("user %d: %w", u.ID, err)
+		}
+		added++
+	}
+	return added, merged, nil
+}
+
+// restoreUser puts the given archived user, who is not in the store
+func restoreUser(u archivedUser) error {
+	user, err := encryptUserTokens(u.User)
+	if err != nil {
+		return err
+	}
+	if user.CalendarToken != "" { // along with the calendar token index
+		err = store.ReplaceCalendarToken(user, "")
+	} else {
+		err = store.PutUser(user)
+	}
+	if err != nil {
+		return err
+	}
+	if len(u.AlertRules) > 0 {
+		if err = store.PutAlertRules(u.ID, u.AlertRules[:min(len(u.AlertRules), MaxAlertRules)]); err != nil {
+			return err
+		}
+	}
+	if len(u.KnownExams) > 0 {
+		if err = store.PutKnownExams(u.ID, u.KnownExams); err != nil {
+			return err
+		}
+	}
+	return store.PutDeliveredNotices(u.ID, u.DeliveredNotices)
+}
+
+// mergeUser merges the given archived user into the given existing one, see Restore
+func mergeUser(existing User, u archivedUser) error {
+	if u.User.TokenExpiry > existing.TokenExpiry {
+		existing.AccessToken = u.User.AccessToken
+		existing.RefreshToken = u.User.RefreshToken
+		existing.TokenExpiry = u.User.TokenExpiry
+		if err := PutUser(existing); err != nil {
+			return err
+		}
+	}
+
+	rules, err := store.GetAlertRules(u.ID)
+	if err != nil {
+		return err
+	}
+	n := len(rules)
+	for _, rule := range u.AlertRules {
+		if len(rules) >= MaxAlertRules { // the archived rules beyond the limit are dropped
+			break
+		}
+		if !containsAlertRule(rules, rule) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) > n {
+		if err = store.PutAlertRules(u.ID, rules); err != nil {
+			return err
+		}
+	}
+
+	exams, err := store.GetKnownExams(u.ID)
+	if err != nil {
+		return err
+	}
+	n = len(exams)
+	for ID, e := range u.KnownExams {
+		if _, ok := exams[ID]; !ok {
+			exams[ID] = e
+		}
+	}
+	if len(exams) > n {
+		if err = store.PutKnownExams(u.ID, exams); err != nil {
+			return err
+		}
+	}
+
+	delivered, err := store.GetDeliveredNotices(u.ID)
+	if err != nil {
+		return err
+	}
+	missing := make(map[int32]DeliveredNotice)
+	for ID, d := range u.DeliveredNotices {
+		if _, ok := delivered[ID]; !ok {
+			missing[ID] = d
+		}
+	}
+	return store.PutDeliveredNotices(u.ID, missing)
+}
+
+// containsAlertRule returns whether the given alert rules contain one with the same pattern as the given one
+func containsAlertRule(rules []AlertRule, rule AlertRule) bool {
+	for _, r := range rules {
+		if r.Pattern == rule.Pattern && r.CaseInsensitive == rule.CaseInsensitive {
+			return true
+		}
+	}
+	return false
+}
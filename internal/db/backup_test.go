@@ -0,0 +1,80 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBackupRestore(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	store = newMemoryStore()
+	_ = PutUser(User{ID: 1, AccessToken: "access-token-1", TokenExpiry: 100, LanguageCode: "ca"})
+	_ = PutUser(User{ID: 2, AccessToken: "a2", TokenExpiry: 100})
+	_ = PutAlertRules(1, []AlertRule{{Pattern: "examen"}})
+	_ = PutSubjectUPCCodes(map[string]uint32{"IES": 270020})
+
+	var buf bytes.Buffer
+	if count, err := Backup(&buf, key); err != nil || count != 2 {
+		t.Fatalf("backup: got %d, %v", count, err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("access-token-1")) {
+		t.Error("encrypted archive contains a token in plaintext")
+	}
+
+	store = newMemoryStore()
+	_ = PutUser(User{ID: 1, AccessToken: "newer", TokenExpiry: 200, LanguageCode: "en"})
+	_ = PutAlertRules(1, []AlertRule{{Pattern: "aula"}})
+	if _, _, err := Restore(bytes.NewReader(buf.Bytes()), nil); err != ErrArchiveEncrypted {
+		t.Errorf("restore without key: got %v, want %v", err, ErrArchiveEncrypted)
+	}
+	added, merged, err := Restore(bytes.NewReader(buf.Bytes()), key)
+	if err != nil || added != 1 || merged != 1 {
+		t.Fatalf("restore: got %d added, %d merged, %v", added, merged, err)
+	}
+
+	user, _ := GetUser(1)
+	if diff := cmp.Diff(User{ID: 1, AccessToken: "newer", TokenExpiry: 200, LanguageCode: "en"}, user); diff != "" {
+		t.Errorf("merged user mismatch (-want +got):\n%s", diff)
+	}
+	rules, _ := GetAlertRules(1)
+	if diff := cmp.Diff([]AlertRule{{Pattern: "aula"}, {Pattern: "examen"}}, rules); diff != "" {
+		t.Errorf("merged alert rules mismatch (-want +got):\n%s", diff)
+	}
+	if user, err = GetUser(2); err != nil || user.AccessToken != "a2" {
+		t.Errorf("added user: got %+v, %v", user, err)
+	}
+	if code, err := GetSubjectUPCCode("IES"); err != nil || code != 270020 {
+		t.Errorf("subject code: got %d, %v", code, err)
+	}
+}
+
+func TestRestoreAlertRulesLimit(t *testing.T) {
+	rules := func(prefix string, n int) []AlertRule {
+		rules := make([]AlertRule, n)
+		for i := range rules {
+			rules[i] = AlertRule{Pattern: fmt.Sprintf("%s%d", prefix, i)}
+		}
+		return rules
+	}
+	store = newMemoryStore()
+	_ = PutUser(User{ID: 1})
+	_ = PutAlertRules(1, rules("archived", 6))
+	var buf bytes.Buffer
+	if _, err := Backup(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	store = newMemoryStore()
+	_ = PutUser(User{ID: 1})
+	_ = PutAlertRules(1, rules("existing", 6))
+	if _, _, err := Restore(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := GetAlertRules(1)
+	if diff := cmp.Diff(append(rules("existing", 6), rules("archived", 4)...), got); diff != "" {
+		t.Errorf("merged alert rules mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// tokenCiphertextPrefix prefixes encrypted tokens, which are `enc:<key ID>:<base64 of nonce and ciphertext>`,
+// so they can be told from the plaintext ones stored before encryption was enabled
+const tokenCiphertextPrefix = "enc:"
+
+// encryptionKeyLength is the length of encryption keys, for AES-256
+const encryptionKeyLength = 32
+
+// errors
+var (
+	ErrEncryptionKeyNotFound = errors.New("db: encryption key not found")
+	errMalformedCiphertext   = errors.New("db: malformed ciphertext")
+)
+
+// tokenCipher encrypts and decrypts users' OAuth tokens with AES-GCM,
+// using the current key for encryption, and the key with the ID stored along the ciphertext for decryption
+type tokenCipher struct {
+	keyID string
+	keys  map[string]cipher.AEAD
+}
+
+// tokens is the cipher of users' OAuth tokens, nil if encryption is disabled (no key configured)
+var tokens *tokenCipher
+
+// loadEncryptionKeys loads the encryption keys (by key ID) configured in the given configuration,
+// along with the ones in its key file (if any), which is a TOML file of key IDs to base64-encoded keys
+func loadEncryptionKeys(config StoreConfig) (map[string]string, error) {
+	keys := make(map[string]string, len(config.EncryptionKeys))
+	for ID, key := range config.EncryptionKeys {
+		keys[ID] = key
+	}
+	if config.EncryptionKeyFile != "" {
+		f, err := os.ReadFile(config.EncryptionKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var fileKeys map[string]string
+		if err = toml.Unmarshal(f, &fileKeys); err != nil {
+			return nil, err
+		}
+		for ID, key := range fileKeys {
+			keys[ID] = key
+		}
+	}
+	return keys, nil
+}
+
+// newTokenCipher makes a tokenCipher with the given base64-encoded keys (by key ID), encrypting with the given one
+func newTokenCipher(keys map[string]string, keyID string) (*tokenCipher, error) {
+	if _, ok := keys[keyID]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrEncryptionKeyNotFound, keyID)
+	}
+	tc := &tokenCipher{keyID: keyID, keys: make(map[string]cipher.AEAD, len(keys))}
+	for ID, encoded := range keys {
+		if ID == "" || strings.Contains(ID, ":") {
+			return nil, fmt.Errorf("invalid encryption key ID %q", ID)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %q: %w", ID, err)
+		}
+		if len(key) != encryptionKeyLength {
+			return nil, fmt.Errorf("invalid encryption key %q: must be %d bytes long", ID, encryptionKeyLength)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if tc.keys[ID], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return tc, nil
+}
+
+// tokenAdditionalData binds a ciphertext to the user and field it belongs to, so it can't be swapped with another one
+func tokenAdditionalData(userID int64, field string) []byte {
+	return []byte(strconv.FormatInt(userID, 10) + ":" + field)
+}
+
+// encrypt encrypts the given token in the given field of a user with the given ID with the current key
+func (tc *tokenCipher) encrypt(userID int64, field, token string) (string, error) {
+	aead := tc.keys[tc.keyID]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(token)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(token), tokenAdditionalData(userID, field))
+	return tokenCiphertextPrefix + tc.keyID + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt decrypts the given encrypted token in the given field of a user with the given ID,
+// plaintext tokens are returned as is
+func (tc *tokenCipher) decrypt(userID int64, field, value string) (string, error) {
+	if !strings.HasPrefix(value, tokenCiphertextPrefix) {
+		return value, nil
+	}
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(value, tokenCiphertextPrefix), ":")
+	if !ok {
+		return "", errMalformedCiphertext
+	}
+	aead, ok := tc.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrEncryptionKeyNotFound, keyID)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errMalformedCiphertext
+	}
+	token, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], tokenAdditionalData(userID, field))
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+// isCurrent returns whether the given token is empty or encrypted with the current key
+func (tc *tokenCipher) isCurrent(value string) bool {
+	return value == "" || strings.HasPrefix(value, tokenCiphertextPrefix+tc.keyID+":")
+}
+
+// encryptUserTokens returns the given user with their OAuth tokens encrypted, as is if encryption is disabled
+func encryptUserTokens(user User) (User, error) {
+	if tokens == nil {
+		return user, nil
+	}
+	var err error
+	if user.AccessToken != "" {
+		if user.AccessToken, err = tokens.encrypt(user.ID, "a", user.AccessToken); err != nil {
+			return User{}, err
+		}
+	}
+	if user.RefreshToken != "" {
+		if user.RefreshToken, err = tokens.encrypt(user.ID, "r", user.RefreshToken); err != nil {
+			return User{}, err
+		}
+	}
+	return user, nil
+}
+
+// decryptUserTokens returns the given user with their OAuth tokens decrypted
+func decryptUserTokens(user User) (User, error) {
+	if tokens == nil {
+		if strings.HasPrefix(user.AccessToken, tokenCiphertextPrefix) || strings.HasPrefix(user.RefreshToken, tokenCiphertextPrefix) {
+			return User{}, ErrEncryptionKeyNotFound
+		}
+		return user, nil
+	}
+	var err error
+	if user.AccessToken, err = tokens.decrypt(user.ID, "a", user.AccessToken); err != nil {
+		return User{}, err
+	}
+	if user.RefreshToken, err = tokens.decrypt(user.ID, "r", user.RefreshToken); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenCipher(t *testing.T) {
+	oldKeys := map[string]string{"1": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}
+	old, err := newTokenCipher(oldKeys, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := old.encrypt(42, "a", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, "enc:1:") || strings.Contains(encrypted, "token") {
+		t.Errorf("got encrypted token %q", encrypted)
+	}
+
+	// rotated to a new key, the old one is kept for decryption
+	tc, err := newTokenCipher(map[string]string{"1": oldKeys["1"], "2": "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="}, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.isCurrent(encrypted) {
+		t.Error("token encrypted with the old key: got current")
+	}
+	if got, err := tc.decrypt(42, "a", encrypted); err != nil || got != "token" {
+		t.Errorf("decrypt: got %q, %v", got, err)
+	}
+	if _, err = tc.decrypt(43, "a", encrypted); err == nil {
+		t.Error("decrypt token of another user: got no error")
+	}
+	if got, err := tc.decrypt(42, "a", "plaintext"); err != nil || got != "plaintext" {
+		t.Errorf("decrypt plaintext: got %q, %v", got, err)
+	}
+
+	if _, err = newTokenCipher(oldKeys, "2"); err == nil {
+		t.Error("unknown current key ID: got no error")
+	}
+}
@@ -9,6 +9,18 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// StoreConfig represents a configuration for the storage backend
+type StoreConfig struct {
+	Backend string `toml:"backend,omitempty"` // `redis` (default), `bolt` (embedded single-file DB) or `memory`
+	Path    string `toml:"path,omitempty"`    // DB file path for the `bolt` backend
+
+	// keys (base64-encoded, 32 bytes) by key ID for encrypting users' OAuth tokens, no encryption if none,
+	// keys in the key file (a TOML file of key IDs to keys) are added to the ones here
+	EncryptionKeys    map[string]string `toml:"encryption_keys,omitempty"`
+	EncryptionKeyFile string            `toml:"encryption_key_file,omitempty"`
+	EncryptionKeyID   string            `toml:"encryption_key_id,omitempty"` // ID of the key to encrypt with, others are only for decryption
+}
+
 // Config represents a configuration for redis connection
 type Config struct {
 	Address  string `toml:"address"`
@@ -17,41 +29,101 @@ type Config struct {
 	DB       int    `toml:"db"`
 }
 
+// storage backends
+const (
+	BackendRedis  = "redis"
+	BackendBolt   = "bolt"
+	BackendMemory = "memory"
+)
+
 var (
-	ctx         = context.Background()
-	rdb         *redis.Client
-	RateLimiter *redis_rate.Limiter
+	ctx   = context.Background()
+	store Store
 )
 
-// Init initializes the DB clients
-func Init(config Config) {
+// Init initializes the DB with the given storage backend configuration,
+// the redis connection configuration is only used by the `redis` backend
+func Init(storeConfig StoreConfig, config Config) {
+	keys, err := loadEncryptionKeys(storeConfig)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	if len(keys) > 0 {
+		if tokens, err = newTokenCipher(keys, storeConfig.EncryptionKeyID); err != nil {
+			log.Fatalf("Failed to set up encryption: %v", err)
+		}
+	} else {
+		log.Warn("no encryption key configured, OAuth tokens are stored in plaintext")
+	}
+
+	switch storeConfig.Backend {
+	case "", BackendRedis:
+		store, err = newRedisStore(config)
+	case BackendBolt:
+		store, err = newBoltStore(storeConfig.Path)
+	case BackendMemory:
+		store = newMemoryStore()
+	default:
+		log.Fatalf("unknown storage backend %q", storeConfig.Backend)
+	}
+	if err != nil {
+		log.Fatalf("Failed to connect to DB: %v", err)
+	}
+
+	log.Debugf("DB connected (%s)", store)
+}
+
+// Close closes the DB
+func Close() {
+	if store != nil {
+		if err := store.Close(); err != nil {
+			log.Errorf("failed to close DB: %v", err)
+		}
+	}
+	log.Debug("DB closed")
+}
+
+// redisStore is a Store backed by a redis server
+type redisStore struct {
+	rdb     *redis.Client
+	limiter *redis_rate.Limiter
+}
+
+// newRedisStore connects to the redis server with the given configuration
+func newRedisStore(config Config) (*redisStore, error) {
 	addrType := "tcp"
 	if strings.HasPrefix(config.Address, "/") { // for unix sockets
 		addrType = "unix"
 	}
 
-	rdb = redis.NewClient(&redis.Options{
+	rdb := redis.NewClient(&redis.Options{
 		Network:  addrType,
 		Addr:     config.Address,
 		Username: config.Username,
 		Password: config.Password,
 		DB:       config.DB,
 	})
-	if res, err := rdb.Ping(ctx).Result(); err != nil || res != "PONG" {
-		log.Fatalf("Failed to connect to DB: %v", err)
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return nil, err
 	}
+	return &redisStore{rdb: rdb, limiter: redis_rate.NewLimiter(rdb)}, nil
+}
 
-	RateLimiter = redis_rate.NewLimiter(rdb)
+// String returns the name of the backend
+func (rs *redisStore) String() string {
+	return BackendRedis
+}
 
-	log.Debug("DB connected")
+// Close closes the connection to the redis server
+func (rs *redisStore) Close() error {
+	return rs.rdb.Close()
 }
 
-// Close closes the DB
-func Close() {
-	if rdb != nil {
-		if err := rdb.Close(); err != nil {
-			log.Errorf("failed to close DB: %v", err)
-		}
+// Allow checks if an event with the given key is allowed under the given limit, and counts it if so
+func (rs *redisStore) Allow(ctx context.Context, key string, limit Limit) (bool, error) {
+	res, err := rs.limiter.Allow(ctx, key, redis_rate.Limit{Rate: limit.Rate, Burst: limit.Rate, Period: limit.Period})
+	if err != nil {
+		return false, err
 	}
-	log.Debug("DB closed")
+	return res.Allowed != 0, nil
 }
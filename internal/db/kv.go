@@ -0,0 +1,1083 @@
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// kvEngine represents an embedded ordered key-value engine with buckets and transactions
+type kvEngine interface {
+	view(fn func(tx kvTx) error) error   // runs fn in a read-only transaction
+	update(fn func(tx kvTx) error) error // runs fn in a read-write transaction, which is rolled back if fn fails
+	close() error
+}
+
+// kvTx represents a transaction of a kvEngine
+// values returned by it are only valid during the transaction and must not be modified
+type kvTx interface {
+	get(bucket, key string) []byte // nil if not found
+	put(bucket, key string, value []byte) error
+	del(bucket, key string) error
+	// scan calls fn for each key (in order) with the given prefix in the bucket,
+	// the bucket must not be modified during the scan
+	scan(bucket, prefix string, fn func(key string, value []byte) error) error
+	// scanFrom calls fn for each key (in order) from the given one (inclusive) to the end of the bucket,
+	// the bucket must not be modified during the scan
+	scanFrom(bucket, from string, fn func(key string, value []byte) error) error
+}
+
+// bucket names
+const (
+	bucketLoginSessions  = "sessions"
+	bucketUsers          = "users"
+	bucketCalendarTokens = "calendar_tokens"
+	bucketKnownExams     = "known_exams" // keys of `userID:examID`
+	bucketAlertRules     = "alert_rules"
+	bucketDelivered      = "delivered" // keys of `userID:noticeID`
+	bucketValidators     = "validators"
+	bucketSnapshots      = "snapshots" // keys of `noticeID:hash`
+	bucketSubjectCodes   = "subject_codes"
+	bucketReminders      = "reminders"
+	bucketRemindersDue   = "reminders_due" // keys of `dueTimestamp:ID`
+	bucketOutbox         = "outbox"
+	bucketOutboxDue      = "outbox_due"   // keys of `dueTimestamp:ID`
+	bucketDeadLetters    = "dead_letters" // keys of `timestamp:ID`, oldest first
+	bucketLeases         = "leases"
+	bucketRateLimits     = "rate_limits"
+	bucketMeta           = "meta"
+)
+
+// key names in the meta bucket
+const (
+	keyMetaSchemaVersion = "schema_version"
+)
+
+const (
+	kvValueExpiresAtLength  = 8  // length of the expiration prefix of values
+	kvTimestampKeyDigits    = 20 // zero-padded, for keys to sort by their timestamps
+	kvTimestampKeySeparator = ":"
+)
+
+var (
+	errStopScan   = errors.New("db: stop scan") // returned by scan callbacks to stop early without failing
+	errReadOnlyTx = errors.New("db: read-only transaction")
+)
+
+var kvBuckets = []string{
+	bucketLoginSessions,
+	bucketUsers,
+	bucketCalendarTokens,
+	bucketKnownExams,
+	bucketAlertRules,
+	bucketDelivered,
+	bucketValidators,
+	bucketSnapshots,
+	bucketSubjectCodes,
+	bucketReminders,
+	bucketRemindersDue,
+	bucketOutbox,
+	bucketOutboxDue,
+	bucketDeadLetters,
+	bucketLeases,
+	bucketRateLimits,
+	bucketMeta,
+}
+
+// kvStore is a Store backed by a kvEngine, for deployments without a redis server
+// each value is prefixed with its expiration (big-endian UNIX nanoseconds, 0 for none), expired ones are ignored
+type kvStore struct {
+	name   string
+	engine kvEngine
+	stop   chan struct{} // closed to stop the sweeper, see startSweeper
+}
+
+// kvQueueItem represents an item of a queue (reminders or outbound notices) in a kvStore
+type kvQueueItem struct {
+	DueAt int64           `json:"t"`
+	Data  json.RawMessage `json:"d"`
+}
+
+// getKV gets the unexpired value with the given key in the given bucket, nil if not found
+func getKV(tx kvTx, bucket, key string) []byte {
+	value, ok := unwrapKV(tx.get(bucket, key), time.Now())
+	if !ok {
+		return nil
+	}
+	return value
+}
+
+// putKV puts the given value with the given key in the given bucket, which expires after the given TTL (0 for never)
+func putKV(tx kvTx, bucket, key string, value []byte, ttl time.Duration) error {
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixNano()
+	}
+	buf := make([]byte, kvValueExpiresAtLength+len(value))
+	binary.BigEndian.PutUint64(buf, uint64(expiresAt))
+	copy(buf[kvValueExpiresAtLength:], value)
+	return tx.put(bucket, key, buf)
+}
+
+// scanKV calls fn for each unexpired value with the given key prefix in the given bucket
+func scanKV(tx kvTx, bucket, prefix string, fn func(key string, value []byte) error) error {
+	return tx.scan(bucket, prefix, unexpiredKV(fn))
+}
+
+// scanKVFrom calls fn for each unexpired value from the given key (inclusive) in the given bucket
+func scanKVFrom(tx kvTx, bucket, from string, fn func(key string, value []byte) error) error {
+	return tx.scanFrom(bucket, from, unexpiredKV(fn))
+}
+
+// unexpiredKV wraps the given scan callback so it's only called with unexpired values, stripping their expirations
+func unexpiredKV(fn func(key string, value []byte) error) func(key string, raw []byte) error {
+	now := time.Now()
+	return func(key string, raw []byte) error {
+		if value, ok := unwrapKV(raw, now); ok {
+			return fn(key, value)
+		}
+		return nil
+	}
+}
+
+// delKVPrefix deletes all keys with the given prefix in the given bucket
+func delKVPrefix(tx kvTx, bucket, prefix string) error {
+	var keys []string
+	if err := tx.scan(bucket, prefix, func(key string, _ []byte) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := tx.del(bucket, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unwrapKV strips the expiration from the given raw value, returning false if it's not found or has expired
+func unwrapKV(raw []byte, now time.Time) ([]byte, bool) {
+	if len(raw) < kvValueExpiresAtLength {
+		return nil, false
+	}
+	expiresAt := int64(binary.BigEndian.Uint64(raw))
+	if expiresAt != 0 && expiresAt <= now.UnixNano() {
+		return nil, false
+	}
+	return raw[kvValueExpiresAtLength:], true
+}
+
+// timestampKey makes a key which sorts by the given timestamp, then by the given ID
+func timestampKey(timestamp int64, ID string) string {
+	return fmt.Sprintf("%0*d%s%s", kvTimestampKeyDigits, max(timestamp, 0), kvTimestampKeySeparator, ID)
+}
+
+// kvSweepInterval is the interval of deleting expired values, which are otherwise only ignored
+const kvSweepInterval = 10 * time.Minute
+
+// startSweeper starts deleting expired values periodically, until the store is closed
+func (ks *kvStore) startSweeper() {
+	ks.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(kvSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ks.stop:
+				return
+			case <-ticker.C:
+				if err := ks.sweepExpired(); err != nil {
+					log.Errorf("failed to sweep expired values: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// sweepExpired deletes all expired values
+func (ks *kvStore) sweepExpired() error {
+	now := time.Now()
+	return ks.engine.update(func(tx kvTx) error {
+		for _, bucket := range kvBuckets {
+			var keys []string
+			if err := tx.scan(bucket, "", func(key string, raw []byte) error {
+				if _, ok := unwrapKV(raw, now); !ok {
+					keys = append(keys, key)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if err := tx.del(bucket, key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// String returns the name of the backend
+func (ks *kvStore) String() string {
+	return ks.name
+}
+
+// Close stops the sweeper and closes the underlying engine
+func (ks *kvStore) Close() error {
+	if ks.stop != nil {
+		close(ks.stop)
+	}
+	return ks.engine.close()
+}
+
+// GetLoginSession gets a login session with the given state
+func (ks *kvStore) GetLoginSession(state string) (s LoginSession, err error) {
+	err = ks.engine.view(func(tx kvTx) error {
+		value := getKV(tx, bucketLoginSessions, state)
+		if value == nil {
+			return ErrLoginSessionNotFound
+		}
+		return json.Unmarshal(value, &s)
+	})
+	if err != nil {
+		return LoginSession{}, err
+	}
+	s.State = state
+	return s, nil
+}
+
+// PutLoginSession puts the given login session
+func (ks *kvStore) PutLoginSession(s LoginSession) error {
+	value, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ks.engine.update(func(tx kvTx) error {
+		return putKV(tx, bucketLoginSessions, s.State, value, ttlLoginSession)
+	})
+}
+
+// DelLoginSession deletes a login session with the given state
+func (ks *kvStore) DelLoginSession(state string) error {
+	return ks.engine.update(func(tx kvTx) error {
+		return tx.del(bucketLoginSessions, state)
+	})
+}
+
+// GetUser gets a user with the given ID
+func (ks *kvStore) GetUser(userID int64) (u User, err error) {
+	err = ks.engine.view(func(tx kvTx) error {
+		value := getKV(tx, bucketUsers, strconv.FormatInt(userID, 10))
+		if value == nil {
+			return ErrUserNotFound
+		}
+		return json.Unmarshal(value, &u)
+	})
+	if err != nil {
+		return User{}, err
+	}
+	u.ID = userID
+	return u, nil
+}
+
+// PutUser puts the given user
+func (ks *kvStore) PutUser(user User) error {
+	value, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return ks.engine.update(func(tx kvTx) error {
+		return putKV(tx, bucketUsers, strconv.FormatInt(user.ID, 10), value, ttlUser)
+	})
+}
+
+// CompareAndPutUser puts the given user only if their stored record is still the given old one,
+// returning whether it has been put, i.e., false if it has been changed (or deleted) since it was got
+func (ks *kvStore) CompareAndPutUser(old, user User) (put bool, err error) {
+	value, err := json.Marshal(user)
+	if err != nil {
+		return false, err
+	}
+	key := strconv.FormatInt(user.ID, 10)
+	err = ks.engine.update(func(tx kvTx) error {
+		current := getKV(tx, bucketUsers, key)
+		if current == nil {
+			return nil
+		}
+		var u User
+		if err := json.Unmarshal(current, &u); err != nil {
+			return err
+		}
+		u.ID = user.ID
+		if !reflect.DeepEqual(u, old) {
+			return nil
+		}
+		put = true
+		return putKV(tx, bucketUsers, key, value, ttlUser)
+	})
+	if err != nil {
+		return false, err
+	}
+	return put, nil
+}
+
+// DelUser deletes a user with the given ID, along with their calendar token, known exams, alert rules and delivered notices
+func (ks *kvStore) DelUser(userID int64) error {
+	key := strconv.FormatInt(userID, 10)
+	return ks.engine.update(func(tx kvTx) error {
+		value := getKV(tx, bucketUsers, key)
+		if value == nil {
+			return nil
+		}
+		var u User
+		if err := json.Unmarshal(value, &u); err != nil {
+			return err
+		}
+
+		if u.CalendarToken != "" {
+			if err := tx.del(bucketCalendarTokens, u.CalendarToken); err != nil {
+				return err
+			}
+		}
+		if err := tx.del(bucketAlertRules, key); err != nil {
+			return err
+		}
+		if err := delKVPrefix(tx, bucketKnownExams, key+":"); err != nil {
+			return err
+		}
+		if err := delKVPrefix(tx, bucketDelivered, key+":"); err != nil {
+			return err
+		}
+		if err := tx.del(bucketValidators, key); err != nil {
+			return err
+		}
+		return tx.del(bucketUsers, key)
+	})
+}
+
+// ScanUserIDs gets a page of `count` user IDs after the given cursor ("" for the first page),
+// along with the cursor of the next page ("" if it's the last one)
+// the users bucket is ordered by user IDs (as strings), so the cursor is simply the last one of the page,
+// and the next page starts right after it
+func (ks *kvStore) ScanUserIDs(cursor string, count int64) (userIDs []int64, next string, err error) {
+	from := ""
+	if cursor != "" {
+		from = cursor + "\x00" // the smallest key after the cursor
+	}
+	err = ks.engine.view(func(tx kvTx) error {
+		return scanKVFrom(tx, bucketUsers, from, func(key string, _ []byte) error {
+			if int64(len(userIDs)) >= count {
+				next = cursor
+				return errStopScan
+			}
+			ID, err := strconv.ParseInt(key, 10, 64)
+			if err != nil {
+				return err
+			}
+			userIDs = append(userIDs, ID)
+			cursor = key
+			return nil
+		})
+	})
+	if err != nil && err != errStopScan {
+		return nil, "", err
+	}
+	return userIDs, next, nil
+}
+
+// ReplaceCalendarToken puts the given user along with their calendar feed token, revoking the given old one (if any)
+func (ks *kvStore) ReplaceCalendarToken(user User, oldToken string) error {
+	value, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	userID := strconv.FormatInt(user.ID, 10)
+	return ks.engine.update(func(tx kvTx) error {
+		if oldToken != "" {
+			if err := tx.del(bucketCalendarTokens, oldToken); err != nil {
+				return err
+			}
+		}
+		if err := putKV(tx, bucketCalendarTokens, user.CalendarToken, []byte(userID), ttlUser); err != nil {
+			return err
+		}
+		return putKV(tx, bucketUsers, userID, value, ttlUser)
+	})
+}
+
+// GetCalendarTokenUserID gets the ID of the user who owns the given calendar feed token
+func (ks *kvStore) GetCalendarTokenUserID(token string) (userID int64, err error) {
+	err = ks.engine.view(func(tx kvTx) error {
+		value := getKV(tx, bucketCalendarTokens, token)
+		if value == nil {
+			return ErrCalendarTokenNotFound
+		}
+		userID, err = strconv.ParseInt(string(value), 10, 64)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// GetKnownExams gets the last known states of the exams of a user with the given ID, by exam ID
+func (ks *kvStore) GetKnownExams(userID int64) (map[int32]KnownExam, error) {
+	prefix := strconv.FormatInt(userID, 10) + ":"
+	exams := make(map[int32]KnownExam)
+	err := ks.engine.view(func(tx kvTx) error {
+		return scanKV(tx, bucketKnownExams, prefix, func(key string, value []byte) error {
+			ID, err := strconv.ParseInt(strings.TrimPrefix(key, prefix), 10, 32)
+			if err != nil {
+				return err
+			}
+			var e KnownExam
+			if err = json.Unmarshal(value, &e); err != nil {
+				return err
+			}
+			exams[int32(ID)] = e
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exams, nil
+}
+
+// PutKnownExams replaces the last known states of the exams of a user with the given ID
+func (ks *kvStore) PutKnownExams(userID int64, exams map[int32]KnownExam) error {
+	prefix := strconv.FormatInt(userID, 10) + ":"
+	values := make(map[string][]byte, len(exams))
+	for ID, e := range exams {
+		value, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		values[prefix+strconv.FormatInt(int64(ID), 10)] = value
+	}
+
+	return ks.engine.update(func(tx kvTx) error {
+		if err := delKVPrefix(tx, bucketKnownExams, prefix); err != nil {
+			return err
+		}
+		for key, value := range values {
+			if err := putKV(tx, bucketKnownExams, key, value, ttlUser); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetAlertRules gets the alert rules of a user with the given ID
+func (ks *kvStore) GetAlertRules(userID int64) (rules []AlertRule, err error) {
+	err = ks.engine.view(func(tx kvTx) error {
+		value := getKV(tx, bucketAlertRules, strconv.FormatInt(userID, 10))
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, &rules)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// PutAlertRules replaces the alert rules of a user with the given ID
+func (ks *kvStore) PutAlertRules(userID int64, rules []AlertRule) error {
+	key := strconv.FormatInt(userID, 10)
+	if len(rules) == 0 {
+		return ks.engine.update(func(tx kvTx) error {
+			return tx.del(bucketAlertRules, key)
+		})
+	}
+	value, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	return ks.engine.update(func(tx kvTx) error {
+		return putKV(tx, bucketAlertRules, key, value, ttlUser)
+	})
+}
+
+// GetNoticesValidators gets the validators of the last fetched notices of a user with the given ID,
+// zero if there are none
+func (ks *kvStore) GetNoticesValidators(userID int64) (v NoticesValidators, err error) {
+	err = ks.engine.view(func(tx kvTx) error {
+		value := getKV(tx, bucketValidators, strconv.FormatInt(userID, 10))
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, &v)
+	})
+	if err != nil {
+		return NoticesValidators{}, err
+	}
+	return v, nil
+}
+
+// PutNoticesValidators replaces the validators of the last fetched notices of a user with the given ID
+func (ks *kvStore) PutNoticesValidators(userID int64, v NoticesValidators) error {
+	key := strconv.FormatInt(userID, 10)
+	if v == (NoticesValidators{}) {
+		return ks.engine.update(func(tx kvTx) error {
+			return tx.del(bucketValidators, key)
+		})
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ks.engine.update(func(tx kvTx) error {
+		return putKV(tx, bucketValidators, key, value, ttlValidators)
+	})
+}
+
+// GetDeliveredNotices gets the notices delivered to a user with the given ID, by notice ID
+func (ks *kvStore) GetDeliveredNotices(userID int64) (map[int32]DeliveredNotice, error) {
+	prefix := strconv.FormatInt(userID, 10) + ":"
+	notices := make(map[int32]DeliveredNotice)
+	err := ks.engine.view(func(tx kvTx) error {
+		return scanKV(tx, bucketDelivered, prefix, func(key string, value []byte) error {
+			ID, err := strconv.ParseInt(strings.TrimPrefix(key, prefix), 10, 32)
+			if err != nil {
+				return err
+			}
+			var n DeliveredNotice
+			if err = json.Unmarshal(value, &n); err != nil {
+				return err
+			}
+			notices[int32(ID)] = n
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notices, nil
+}
+
+// PutDeliveredNotice puts the given delivered notice with the given ID of a user with the given ID
+func (ks *kvStore) PutDeliveredNotice(userID int64, noticeID int32, n DeliveredNotice) error {
+	return ks.PutDeliveredNotices(userID, map[int32]DeliveredNotice{noticeID: n})
+}
+
+// PutDeliveredNotices puts the given delivered notices (by notice ID) of a user with the given ID in bulk
+func (ks *kvStore) PutDeliveredNotices(userID int64, notices map[int32]DeliveredNotice) error {
+	if len(notices) == 0 {
+		return nil
+	}
+	prefix := strconv.FormatInt(userID, 10) + ":"
+	values := make(map[string][]byte, len(notices))
+	for ID, n := range notices {
+		value, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		values[prefix+strconv.FormatInt(int64(ID), 10)] = value
+	}
+
+	return ks.engine.update(func(tx kvTx) error {
+		for key, value := range values {
+			if err := putKV(tx, bucketDelivered, key, value, ttlUser); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DelDeliveredNotices deletes the delivered notices with the given IDs of a user with the given ID
+func (ks *kvStore) DelDeliveredNotices(userID int64, noticeIDs ...int32) error {
+	if len(noticeIDs) == 0 {
+		return nil
+	}
+	prefix := strconv.FormatInt(userID, 10) + ":"
+	return ks.engine.update(func(tx kvTx) error {
+		for _, ID := range noticeIDs {
+			if err := tx.del(bucketDelivered, prefix+strconv.FormatInt(int64(ID), 10)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetNoticeSnapshot gets the snapshot with the given hash of a notice with the given ID
+func (ks *kvStore) GetNoticeSnapshot(noticeID int32, hash string) (s NoticeSnapshot, err error) {
+	key := strconv.FormatInt(int64(noticeID), 10) + ":" + hash
+	err = ks.engine.view(func(tx kvTx) error {
+		value := getKV(tx, bucketSnapshots, key)
+		if value == nil {
+			return ErrNoticeSnapshotNotFound
+		}
+		return json.Unmarshal(value, &s)
+	})
+	if err != nil {
+		return NoticeSnapshot{}, err
+	}
+	s.Hash = hash
+	return s, nil
+}
+
+// PutNoticeSnapshot puts the given snapshot of a notice with the given ID,
+// which is kept until a while after the notice's expiration timestamp
+func (ks *kvStore) PutNoticeSnapshot(noticeID int32, s NoticeSnapshot, expiresAt int64) error {
+	key := strconv.FormatInt(int64(noticeID), 10) + ":" + s.Hash
+	value, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ks.engine.update(func(tx kvTx) error {
+		return putKV(tx, bucketSnapshots, key, value, noticeSnapshotTTL(expiresAt))
+	})
+}
+
+// GetSubjectUPCCode gets the UPC code of a subject with the given acronym
+func (ks *kvStore) GetSubjectUPCCode(acronym string) (code uint32, err error) {
+	err = ks.engine.view(func(tx kvTx) error {
+		value := getKV(tx, bucketSubjectCodes, acronym)
+		if value == nil {
+			return ErrSubjectNotFound
+		}
+		i, err := strconv.ParseUint(string(value), 10, 32)
+		if err != nil {
+			return err
+		}
+		code = uint32(i)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return code, nil
+}
+
+// GetAllSubjectUPCCodes gets the UPC codes of all subjects, by their acronyms
+func (ks *kvStore) GetAllSubjectUPCCodes() (map[string]uint32, error) {
+	codes := make(map[string]uint32)
+	err := ks.engine.view(func(tx kvTx) error {
+		return scanKV(tx, bucketSubjectCodes, "", func(acronym string, value []byte) error {
+			i, err := strconv.ParseUint(string(value), 10, 32)
+			if err != nil {
+				return err
+			}
+			codes[acronym] = uint32(i)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// PutSubjectUPCCode puts the given UPC code of a subject with the given acronym
+func (ks *kvStore) PutSubjectUPCCode(acronym string, code uint32) error {
+	return ks.PutSubjectUPCCodes(map[string]uint32{acronym: code})
+}
+
+// PutSubjectUPCCodes puts the given subject UPC codes in bulk
+func (ks *kvStore) PutSubjectUPCCodes(codes map[string]uint32) error {
+	return ks.engine.update(func(tx kvTx) error {
+		for acronym, code := range codes {
+			value := strconv.FormatUint(uint64(code), 10)
+			if err := putKV(tx, bucketSubjectCodes, acronym, []byte(value), ttlSubjectCode); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DelAllSubjectUPCCodes deletes all subject UPC codes
+func (ks *kvStore) DelAllSubjectUPCCodes() error {
+	return ks.engine.update(func(tx kvTx) error {
+		return delKVPrefix(tx, bucketSubjectCodes, "")
+	})
+}
+
+// Allow checks if an event with the given key is allowed under the given limit, and counts it if so
+// it implements GCRA (same as redis_rate) by keeping the theoretical arrival time of the next event of each key
+func (ks *kvStore) Allow(_ context.Context, key string, limit Limit) (allowed bool, err error) {
+	if limit.Rate <= 0 {
+		return false, nil
+	}
+	interval := limit.Period / time.Duration(limit.Rate)
+	burstOffset := interval * time.Duration(limit.Rate)
+	err = ks.engine.update(func(tx kvTx) error {
+		now := time.Now().UnixNano()
+		tat := now
+		if value := getKV(tx, bucketRateLimits, key); len(value) == 8 {
+			tat = max(tat, int64(binary.BigEndian.Uint64(value)))
+		}
+		newTAT := tat + int64(interval)
+		if now < newTAT-int64(burstOffset) {
+			return nil
+		}
+		allowed = true
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(newTAT))
+		return putKV(tx, bucketRateLimits, key, buf, time.Duration(newTAT-now))
+	})
+	if err != nil {
+		return false, err
+	}
+	return allowed, nil
+}
+
+// putQueueItem puts the given data with the given ID to the queue in the given buckets, to be due at the given time
+// if `onlyIfAbsent` is true, an existing item with the same ID is left untouched and false is returned
+func putQueueItem(tx kvTx, bucket, dueBucket, ID string, data []byte, dueAt int64, onlyIfAbsent bool) (bool, error) {
+	if value := getKV(tx, bucket, ID); value != nil {
+		if onlyIfAbsent {
+			return false, nil
+		}
+		var item kvQueueItem
+		if err := json.Unmarshal(value, &item); err != nil {
+			return false, err
+		}
+		if err := tx.del(dueBucket, timestampKey(item.DueAt, ID)); err != nil {
+			return false, err
+		}
+	}
+	value, err := json.Marshal(kvQueueItem{DueAt: dueAt, Data: data})
+	if err != nil {
+		return false, err
+	}
+	if err = putKV(tx, bucket, ID, value, 0); err != nil {
+		return false, err
+	}
+	return true, putKV(tx, dueBucket, timestampKey(dueAt, ID), nil, 0)
+}
+
+// delQueueItem deletes an item with the given ID from the queue in the given buckets
+func delQueueItem(tx kvTx, bucket, dueBucket, ID string) error {
+	value := getKV(tx, bucket, ID)
+	if value == nil {
+		return nil
+	}
+	var item kvQueueItem
+	if err := json.Unmarshal(value, &item); err != nil {
+		return err
+	}
+	if err := tx.del(dueBucket, timestampKey(item.DueAt, ID)); err != nil {
+		return err
+	}
+	return tx.del(bucket, ID)
+}
+
+// getDueQueueItems gets the IDs and data of at most `count` items which are due at the given time,
+// from the queue in the given buckets, in order of their due timestamps
+func getDueQueueItems(tx kvTx, bucket, dueBucket string, now int64, count int64) (IDs []string, data [][]byte, err error) {
+	var dueKeys []string
+	maxKey := timestampKey(now, "\xff")
+	err = tx.scan(dueBucket, "", func(key string, _ []byte) error {
+		if key > maxKey || int64(len(dueKeys)) >= count {
+			return errStopScan
+		}
+		dueKeys = append(dueKeys, key)
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return nil, nil, err
+	}
+
+	for _, key := range dueKeys {
+		ID := key[kvTimestampKeyDigits+len(kvTimestampKeySeparator):]
+		value := getKV(tx, bucket, ID)
+		if value == nil { // dangling due key
+			if err = tx.del(dueBucket, key); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		var item kvQueueItem
+		if err = json.Unmarshal(value, &item); err != nil {
+			return nil, nil, err
+		}
+		IDs = append(IDs, ID)
+		data = append(data, item.Data)
+	}
+	return IDs, data, nil
+}
+
+// PutReminder puts the given reminder to be due at the given time, fenced by the given fence
+// putting a reminder with an existing ID replaces it and reschedules it
+func (ks *kvStore) PutReminder(r Reminder, dueAt time.Time, fence Fence) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return ks.engine.update(func(tx kvTx) error {
+		if err := checkFence(tx, fence); err != nil {
+			return err
+		}
+		_, err := putQueueItem(tx, bucketReminders, bucketRemindersDue, r.ID, value, dueAt.Unix(), false)
+		return err
+	})
+}
+
+// DelReminder deletes a reminder with the given ID
+func (ks *kvStore) DelReminder(ID string) error {
+	return ks.engine.update(func(tx kvTx) error {
+		return delQueueItem(tx, bucketReminders, bucketRemindersDue, ID)
+	})
+}
+
+// PopDueReminders pops at most `count` reminders which are due at the given time
+// popped reminders are deleted, so each of them is only returned once
+func (ks *kvStore) PopDueReminders(now time.Time, count int64) ([]Reminder, error) {
+	var reminders []Reminder
+	err := ks.engine.update(func(tx kvTx) error {
+		IDs, data, err := getDueQueueItems(tx, bucketReminders, bucketRemindersDue, now.Unix(), count)
+		if err != nil {
+			return err
+		}
+		reminders = make([]Reminder, 0, len(IDs))
+		for i, ID := range IDs {
+			if err = delQueueItem(tx, bucketReminders, bucketRemindersDue, ID); err != nil {
+				return err
+			}
+			var r Reminder
+			if err = json.Unmarshal(data[i], &r); err != nil {
+				log.Errorf("failed to parse reminder %s: %v", ID, err)
+				continue
+			}
+			r.ID = ID
+			reminders = append(reminders, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// EnqueueOutboundNotice queues the given outbound notice to be delivered as soon as possible, fenced by the given fence
+// it returns false if a notice with the same ID is already queued, which is left untouched
+func (ks *kvStore) EnqueueOutboundNotice(n OutboundNotice, fence Fence) (added bool, err error) {
+	value, err := json.Marshal(n)
+	if err != nil {
+		return false, err
+	}
+	err = ks.engine.update(func(tx kvTx) error {
+		if err := checkFence(tx, fence); err != nil {
+			return err
+		}
+		added, err = putQueueItem(tx, bucketOutbox, bucketOutboxDue, n.ID, value, time.Now().Unix(), true)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return added, nil
+}
+
+// ClaimDueOutboundNotices claims at most `count` outbound notices which are due at the given time,
+// each of them must be acked by AckOutboundNotice, RetryOutboundNotice or DeadLetterOutboundNotice before `lease` passes,
+// otherwise it will be claimed again
+func (ks *kvStore) ClaimDueOutboundNotices(now time.Time, count int64, lease time.Duration) ([]OutboundNotice, error) {
+	var notices []OutboundNotice
+	err := ks.engine.update(func(tx kvTx) error {
+		IDs, data, err := getDueQueueItems(tx, bucketOutbox, bucketOutboxDue, now.Unix(), count)
+		if err != nil {
+			return err
+		}
+		notices = make([]OutboundNotice, 0, len(IDs))
+		for i, ID := range IDs {
+			if _, err = putQueueItem(tx, bucketOutbox, bucketOutboxDue, ID, data[i], now.Add(lease).Unix(), false); err != nil {
+				return err
+			}
+			var n OutboundNotice
+			if err = json.Unmarshal(data[i], &n); err != nil {
+				log.Errorf("failed to parse outbound notice %s: %v", ID, err)
+				continue
+			}
+			n.ID = ID
+			notices = append(notices, n)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notices, nil
+}
+
+// AckOutboundNotice deletes the outbound notice with the given ID from the queue, after it has been delivered
+func (ks *kvStore) AckOutboundNotice(ID string) error {
+	return ks.engine.update(func(tx kvTx) error {
+		return delQueueItem(tx, bucketOutbox, bucketOutboxDue, ID)
+	})
+}
+
+// RetryOutboundNotice puts the given outbound notice (with its attempts updated) back to the queue,
+// to be attempted again at the given time
+func (ks *kvStore) RetryOutboundNotice(n OutboundNotice, at time.Time) error {
+	value, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return ks.engine.update(func(tx kvTx) error {
+		_, err := putQueueItem(tx, bucketOutbox, bucketOutboxDue, n.ID, value, at.Unix(), false)
+		return err
+	})
+}
+
+// DeadLetterOutboundNotice moves the given outbound notice from the queue to the dead letters
+func (ks *kvStore) DeadLetterOutboundNotice(n OutboundNotice) error {
+	value, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return ks.engine.update(func(tx kvTx) error {
+		if err := delQueueItem(tx, bucketOutbox, bucketOutboxDue, n.ID); err != nil {
+			return err
+		}
+		if err := putKV(tx, bucketDeadLetters, timestampKey(time.Now().UnixNano(), n.ID), value, 0); err != nil {
+			return err
+		}
+
+		var keys []string
+		if err := tx.scan(bucketDeadLetters, "", func(key string, _ []byte) error {
+			keys = append(keys, key)
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, key := range keys[:max(len(keys)-maxDeadLetters, 0)] { // discard the oldest ones
+			if err := tx.del(bucketDeadLetters, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetDeadLetters gets at most `count` latest dead letters, along with the total number of them
+func (ks *kvStore) GetDeadLetters(count int64) ([]OutboundNotice, int64, error) {
+	var notices []OutboundNotice
+	err := ks.engine.view(func(tx kvTx) error {
+		return scanKV(tx, bucketDeadLetters, "", func(_ string, value []byte) error {
+			var n OutboundNotice
+			if err := json.Unmarshal(value, &n); err != nil {
+				return err
+			}
+			notices = append(notices, n)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	total := int64(len(notices))
+	slices.Reverse(notices) // newest first
+	return notices[:min(count, total)], total, nil
+}
+
+// GetSchemaVersion gets the schema version of the stored records, 0 if it has never been set
+func (ks *kvStore) GetSchemaVersion() (version int, err error) {
+	err = ks.engine.view(func(tx kvTx) error {
+		value := getKV(tx, bucketMeta, keyMetaSchemaVersion)
+		if value == nil {
+			return nil
+		}
+		version, err = strconv.Atoi(string(value))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// PutSchemaVersion puts the schema version of the stored records
+func (ks *kvStore) PutSchemaVersion(version int) error {
+	return ks.engine.update(func(tx kvTx) error {
+		return putKV(tx, bucketMeta, keyMetaSchemaVersion, []byte(strconv.Itoa(version)), 0)
+	})
+}
+
+// GetMeta gets the metadata value with the given name, empty if it has never been set
+func (ks *kvStore) GetMeta(name string) (value string, err error) {
+	err = ks.engine.view(func(tx kvTx) error {
+		value = string(getKV(tx, bucketMeta, name))
+		return nil
+	})
+	return value, err
+}
+
+// PutMeta puts the metadata value with the given name
+func (ks *kvStore) PutMeta(name, value string) error {
+	return ks.engine.update(func(tx kvTx) error {
+		return putKV(tx, bucketMeta, name, []byte(value), 0)
+	})
+}
+
+// AcquireLease acquires the lease with the given name for the given holder for the given TTL,
+// or renews it if it's already held by the holder
+// it returns the fencing token of the holder's term if the holder holds the lease afterwards, 0 otherwise
+func (ks *kvStore) AcquireLease(name, holder string, ttl time.Duration) (token int64, err error) {
+	err = ks.engine.update(func(tx kvTx) error {
+		value := getKV(tx, bucketLeases, name)
+		if value != nil && string(value) != holder {
+			return nil
+		}
+		if token = getLeaseTerm(tx, name); value == nil || token == 0 { // a new term begins
+			token++
+			if err := putKV(tx, bucketLeases, leaseTermKey(name), []byte(strconv.FormatInt(token, 10)), 0); err != nil {
+				return err
+			}
+		}
+		return putKV(tx, bucketLeases, name, []byte(holder), ttl)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return token, nil
+}
+
+// leaseTermKey returns the key of the fencing token of the current term of the lease with the given name, see Fence
+func leaseTermKey(name string) string {
+	return name + kvTimestampKeySeparator + "term"
+}
+
+// getLeaseTerm gets the fencing token of the current term of the lease with the given name, 0 if it has never been held
+func getLeaseTerm(tx kvTx, name string) int64 {
+	token, _ := strconv.ParseInt(string(getKV(tx, bucketLeases, leaseTermKey(name))), 10, 64)
+	return token
+}
+
+// checkFence returns ErrFenced if the given fence's term of its lease has ended
+func checkFence(tx kvTx, fence Fence) error {
+	if fence.Lease != "" && getLeaseTerm(tx, fence.Lease) != fence.Token {
+		return ErrFenced
+	}
+	return nil
+}
+
+// ReleaseLease releases the lease with the given name if it's held by the given holder
+func (ks *kvStore) ReleaseLease(name, holder string) error {
+	return ks.engine.update(func(tx kvTx) error {
+		if string(getKV(tx, bucketLeases, name)) != holder {
+			return nil
+		}
+		return tx.del(bucketLeases, name)
+	})
+}
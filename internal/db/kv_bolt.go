@@ -0,0 +1,104 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// boltOpenTimeout is the timeout of waiting for the lock of the DB file, which is held by another running instance
+const boltOpenTimeout = 5 * time.Second
+
+// boltEngine is a kvEngine backed by a bolt DB file, for single-instance deployments
+type boltEngine struct {
+	db *bbolt.DB
+}
+
+// boltTx is a transaction of a boltEngine
+type boltTx struct {
+	tx *bbolt.Tx
+}
+
+// newBoltStore opens (or creates) the bolt DB file in the given path as a Store
+func newBoltStore(path string) (Store, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no DB file path configured for the %s backend", BackendBolt)
+	}
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Update(func(tx *bbolt.Tx) error {
+		for _, bucket := range kvBuckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	s := &kvStore{
+		name:   fmt.Sprintf("%s (%s)", BackendBolt, path),
+		engine: &boltEngine{db: db},
+	}
+	if err = s.sweepExpired(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	s.startSweeper()
+	return s, nil
+}
+
+func (e *boltEngine) view(fn func(tx kvTx) error) error {
+	return e.db.View(func(tx *bbolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (e *boltEngine) update(fn func(tx kvTx) error) error {
+	return e.db.Update(func(tx *bbolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (e *boltEngine) close() error {
+	return e.db.Close()
+}
+
+func (tx *boltTx) get(bucket, key string) []byte {
+	return tx.tx.Bucket([]byte(bucket)).Get([]byte(key))
+}
+
+func (tx *boltTx) put(bucket, key string, value []byte) error {
+	return tx.tx.Bucket([]byte(bucket)).Put([]byte(key), value)
+}
+
+func (tx *boltTx) del(bucket, key string) error {
+	return tx.tx.Bucket([]byte(bucket)).Delete([]byte(key))
+}
+
+func (tx *boltTx) scan(bucket, prefix string, fn func(key string, value []byte) error) error {
+	p := []byte(prefix)
+	c := tx.tx.Bucket([]byte(bucket)).Cursor()
+	for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		if err := fn(string(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *boltTx) scanFrom(bucket, from string, fn func(key string, value []byte) error) error {
+	c := tx.tx.Bucket([]byte(bucket)).Cursor()
+	for k, v := c.Seek([]byte(from)); k != nil; k, v = c.Next() {
+		if err := fn(string(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
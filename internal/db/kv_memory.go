@@ -0,0 +1,129 @@
+package db
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// memoryEngine is a kvEngine keeping everything in memory, mainly for development and tests
+type memoryEngine struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// memoryTx is a transaction of a memoryEngine, writes are buffered and only applied when it succeeds
+type memoryTx struct {
+	engine *memoryEngine
+	writes map[string]map[string][]byte // nil values for deletions, nil if read-only
+}
+
+// newMemoryStore makes an empty in-memory Store, nothing is persisted
+func newMemoryStore() Store {
+	s := &kvStore{
+		name:   BackendMemory,
+		engine: &memoryEngine{buckets: make(map[string]map[string][]byte)},
+	}
+	s.startSweeper()
+	return s
+}
+
+func (e *memoryEngine) view(fn func(tx kvTx) error) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return fn(&memoryTx{engine: e})
+}
+
+func (e *memoryEngine) update(fn func(tx kvTx) error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	tx := &memoryTx{engine: e, writes: make(map[string]map[string][]byte)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for bucket, writes := range tx.writes {
+		b := e.buckets[bucket]
+		if b == nil {
+			b = make(map[string][]byte)
+			e.buckets[bucket] = b
+		}
+		for key, value := range writes {
+			if value == nil {
+				delete(b, key)
+			} else {
+				b[key] = value
+			}
+		}
+	}
+	return nil
+}
+
+func (e *memoryEngine) close() error {
+	return nil
+}
+
+func (tx *memoryTx) get(bucket, key string) []byte {
+	if value, ok := tx.writes[bucket][key]; ok {
+		return value
+	}
+	return tx.engine.buckets[bucket][key]
+}
+
+func (tx *memoryTx) put(bucket, key string, value []byte) error {
+	if tx.writes == nil {
+		return errReadOnlyTx
+	}
+	if tx.writes[bucket] == nil {
+		tx.writes[bucket] = make(map[string][]byte)
+	}
+	tx.writes[bucket][key] = slices.Clone(value) // never nil, as values are always prefixed with their expirations
+	return nil
+}
+
+func (tx *memoryTx) del(bucket, key string) error {
+	if tx.writes == nil {
+		return errReadOnlyTx
+	}
+	if tx.writes[bucket] == nil {
+		tx.writes[bucket] = make(map[string][]byte)
+	}
+	tx.writes[bucket][key] = nil
+	return nil
+}
+
+func (tx *memoryTx) scan(bucket, prefix string, fn func(key string, value []byte) error) error {
+	return tx.scanKeys(bucket, func(key string) bool { return strings.HasPrefix(key, prefix) }, fn)
+}
+
+func (tx *memoryTx) scanFrom(bucket, from string, fn func(key string, value []byte) error) error {
+	return tx.scanKeys(bucket, func(key string) bool { return key >= from }, fn)
+}
+
+// scanKeys calls fn for each key (in order) in the bucket which matches the given filter
+func (tx *memoryTx) scanKeys(bucket string, filter func(key string) bool, fn func(key string, value []byte) error) error {
+	var keys []string
+	for key := range tx.engine.buckets[bucket] {
+		if filter(key) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range tx.writes[bucket] {
+		if filter(key) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	for _, key := range keys {
+		value := tx.get(bucket, key)
+		if value == nil { // deleted in this transaction
+			continue
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
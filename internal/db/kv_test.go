@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKVStoreAllow(t *testing.T) {
+	s := newMemoryStore()
+	limit := PerMinute(3)
+	var got []bool
+	for i := 0; i < 4; i++ {
+		allowed, err := s.Allow(context.Background(), "k", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, allowed)
+	}
+	if diff := cmp.Diff([]bool{true, true, true, false}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestKVStoreOutbox(t *testing.T) {
+	s := newMemoryStore()
+	now := time.Now()
+	for _, n := range []OutboundNotice{NewOutboundNotice(1, 10, 100, nil), NewOutboundNotice(1, 11, 100, nil)} {
+		if ok, err := s.EnqueueOutboundNotice(n, Fence{}); err != nil || !ok {
+			t.Fatalf("enqueue %s: got %v, %v", n.ID, ok, err)
+		}
+	}
+	if ok, _ := s.EnqueueOutboundNotice(NewOutboundNotice(1, 10, 100, nil), Fence{}); ok {
+		t.Error("enqueue duplicate: got true")
+	}
+
+	claimed, err := s.ClaimDueOutboundNotices(now, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 {
+		t.Fatalf("claim: got %d notices, want 2", len(claimed))
+	}
+	if claimed, _ = s.ClaimDueOutboundNotices(now, 10, time.Minute); len(claimed) != 0 {
+		t.Errorf("claim leased: got %d notices, want 0", len(claimed))
+	}
+
+	if err = s.AckOutboundNotice("1:10:100"); err != nil {
+		t.Fatal(err)
+	}
+	claimed, _ = s.ClaimDueOutboundNotices(now.Add(2*time.Minute), 10, time.Minute)
+	var IDs []string
+	for _, n := range claimed {
+		IDs = append(IDs, n.ID)
+	}
+	if diff := cmp.Diff([]string{"1:11:100"}, IDs); diff != "" {
+		t.Errorf("claim after lease: mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestKVStoreScanUserIDs(t *testing.T) {
+	s := newMemoryStore()
+	for _, ID := range []int64{3, 1, 20, 2} {
+		if err := s.PutUser(User{ID: ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var pages [][]int64
+	cursor := ""
+	for {
+		var page []int64
+		var err error
+		if page, cursor, err = s.ScanUserIDs(cursor, 2); err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+		if cursor == "" {
+			break
+		}
+	}
+	if diff := cmp.Diff([][]int64{{1, 2}, {20, 3}}, pages); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestKVStoreSweepExpired(t *testing.T) {
+	s := newMemoryStore().(*kvStore)
+	defer s.Close()
+	if _, err := s.AcquireLease("expiring", "a", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AcquireLease("lasting", "a", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	if err := s.sweepExpired(); err != nil {
+		t.Fatal(err)
+	}
+	leases := s.engine.(*memoryEngine).buckets[bucketLeases]
+	if _, ok := leases["expiring"]; ok {
+		t.Error("expired lease not swept")
+	}
+	if _, ok := leases["lasting"]; !ok {
+		t.Error("unexpired lease swept")
+	}
+}
+
+func TestKVStoreLease(t *testing.T) {
+	s := newMemoryStore()
+	defer s.Close()
+	acquire := func(holder string, want int64) {
+		t.Helper()
+		if token, err := s.AcquireLease("jobs", holder, time.Minute); err != nil || token != want {
+			t.Errorf("%s acquiring: got token %d, %v, want %d", holder, token, err, want)
+		}
+	}
+
+	acquire("a", 1)
+	acquire("a", 1) // renewed
+	acquire("b", 0)
+	if err := s.ReleaseLease("jobs", "a"); err != nil {
+		t.Fatal(err)
+	}
+	acquire("b", 2) // taken over
+
+	// writes fenced by the ended term are rejected
+	stale, current := Fence{Lease: "jobs", Token: 1}, Fence{Lease: "jobs", Token: 2}
+	if _, err := s.EnqueueOutboundNotice(NewOutboundNotice(1, 10, 100, nil), stale); err != ErrFenced {
+		t.Errorf("enqueueing with a stale fence: got %v", err)
+	}
+	if err := s.PutReminder(Reminder{ID: "r"}, time.Now(), stale); err != ErrFenced {
+		t.Errorf("putting reminder with a stale fence: got %v", err)
+	}
+	if ok, err := s.EnqueueOutboundNotice(NewOutboundNotice(1, 10, 100, nil), current); err != nil || !ok {
+		t.Errorf("enqueueing with the current fence: got %v, %v", ok, err)
+	}
+}
+
+func TestKVStoreNoticeSnapshot(t *testing.T) {
+	s := newMemoryStore()
+	defer s.Close()
+	want := NoticeSnapshot{Hash: "h1", Title: "Avís", Text: "Hola", Attachments: []string{"a.pdf"}}
+	expiresAt := time.Now().Add(-time.Hour).Unix() // kept for a while after the notice expires
+	if err := s.PutNoticeSnapshot(42, want, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetNoticeSnapshot(42, "h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if _, err = s.GetNoticeSnapshot(42, "h2"); err != ErrNoticeSnapshotNotFound {
+		t.Errorf("got error %v for a missing snapshot, want %v", err, ErrNoticeSnapshotNotFound)
+	}
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireLeaseScript acquires the lease KEYS[1] for the holder ARGV[1] for ARGV[2] milliseconds,
+// if it's not held by anyone else, or renews it if it's already held by the holder
+// it returns the fencing token of the holder's term, which is KEYS[2] incremented when the term begins, 0 if not held
+var acquireLeaseScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder == false then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return redis.call('INCR', KEYS[2])
+end
+if holder == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	local token = redis.call('GET', KEYS[2])
+	if token == false then
+		return redis.call('INCR', KEYS[2])
+	end
+	return tonumber(token)
+end
+return 0
+`)
+
+// releaseLeaseScript releases the lease KEYS[1] if it's held by the holder ARGV[1]
+var releaseLeaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// AcquireLease acquires the lease with the given name for the given holder for the given TTL,
+// or renews it if it's already held by the holder
+// it returns the fencing token of the holder's term if the holder holds the lease afterwards, 0 otherwise
+func (rs *redisStore) AcquireLease(name, holder string, ttl time.Duration) (int64, error) {
+	return acquireLeaseScript.Run(ctx, rs.rdb,
+		[]string{keyPrefixLease + ":" + name, keyPrefixLeaseTerm + ":" + name},
+		holder, ttl.Milliseconds()).Int64()
+}
+
+// ReleaseLease releases the lease with the given name if it's held by the given holder
+func (rs *redisStore) ReleaseLease(name, holder string) error {
+	return releaseLeaseScript.Run(ctx, rs.rdb, []string{keyPrefixLease + ":" + name}, holder).Err()
+}
+
+// fenced runs fn in a transaction, which fails with ErrFenced if the given fence's term of its lease has ended
+func (rs *redisStore) fenced(fence Fence, fn func(pipe redis.Pipeliner) error) error {
+	if fence.Lease == "" {
+		_, err := rs.rdb.TxPipelined(ctx, fn)
+		return err
+	}
+	key := keyPrefixLeaseTerm + ":" + fence.Lease
+	err := rs.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		token, err := tx.Get(ctx, key).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if token != fence.Token {
+			return ErrFenced
+		}
+		_, err = tx.TxPipelined(ctx, fn)
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) { // a new term has begun meanwhile
+		return ErrFenced
+	}
+	return err
+}
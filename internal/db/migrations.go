@@ -0,0 +1,260 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Migration represents a migration of stored records from the previous schema version to `Version`
+type Migration struct {
+	Version     int
+	Description string
+	// Migrate migrates the records in the given store, returning the number of records touched,
+	// if `dryRun` is true, nothing is written and the number of records which would be touched is returned instead
+	// it must be idempotent, as it may be interrupted and run again
+	Migrate func(s Store, dryRun bool) (int, error)
+}
+
+// migrations are all migrations in order of their versions, append new ones to the end
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "index existing users",
+		Migrate: func(s Store, dryRun bool) (int, error) {
+			rs, ok := s.(*redisStore)
+			if !ok { // users in a kvStore are already indexed by their bucket
+				return 0, nil
+			}
+			return rs.indexUsers(dryRun)
+		},
+	},
+}
+
+// migrateUserAttempts is the max number of times a user record is migrated, if it keeps being changed meanwhile
+const migrateUserAttempts = 5
+
+// migrateUsers calls fn with each stored user record, and puts the ones it has changed (i.e., returned true),
+// returning the number of them
+// a record is only put if it hasn't been changed meanwhile (e.g., by another instance refreshing the user's token),
+// otherwise it's got and migrated again, so fn must not modify the user's slices or maps in place
+func migrateUsers(s Store, dryRun bool, fn func(u *User) (bool, error)) (int, error) {
+	count := 0
+	seen := make(map[int64]struct{})
+	cursor := ""
+	for {
+		userIDs, next, err := s.ScanUserIDs(cursor, userIDsPageSize)
+		if err != nil {
+			return count, err
+		}
+		for _, userID := range userIDs {
+			if _, ok := seen[userID]; ok {
+				continue
+			}
+			seen[userID] = struct{}{}
+
+			changed, err := migrateUser(s, userID, dryRun, fn)
+			if err != nil {
+				return count, fmt.Errorf("user %d: %w", userID, err)
+			}
+			if changed {
+				count++
+			}
+		}
+		if cursor = next; cursor == "" {
+			return count, nil
+		}
+	}
+}
+
+// migrateUser calls fn with the stored record of the user with the given ID, and puts it if fn has changed it,
+// see migrateUsers
+func migrateUser(s Store, userID int64, dryRun bool, fn func(u *User) (bool, error)) (bool, error) {
+	for attempt := 0; attempt < migrateUserAttempts; attempt++ {
+		u, err := s.GetUser(userID)
+		if err != nil {
+			if errors.Is(err, ErrUserNotFound) { // deleted meanwhile
+				return false, nil
+			}
+			return false, err
+		}
+		old := u
+		changed, err := fn(&u)
+		if err != nil || !changed || dryRun {
+			return changed, err
+		}
+		put, err := s.CompareAndPutUser(old, u)
+		if err != nil || put {
+			return put, err
+		}
+	}
+	return false, fmt.Errorf("changed meanwhile in all %d attempts", migrateUserAttempts)
+}
+
+const (
+	migrationsLeaseName = "migrations"
+	migrationsLeaseTTL  = 30 * time.Second // renewed while migrating, so another instance takes over soon if this one crashes
+)
+
+// SchemaVersion is the schema version of stored records this build works with
+var SchemaVersion = migrations[len(migrations)-1].Version
+
+// Migrate runs the pending migrations in order, updating the schema version after each of them,
+// and then encrypts the stored OAuth tokens with the current key if needed, see reencryptTokens
+// it holds a lease so only one instance migrates at a time, the others wait for it and then find nothing pending
+// if `dryRun` is true, nothing is written and the number of records each pending migration would touch is logged instead
+func Migrate(dryRun bool) error {
+	if !dryRun {
+		release, err := holdMigrationsLease()
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	version, err := store.GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("schema version %d is newer than the supported %d", version, SchemaVersion)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		start := time.Now()
+		count, err := m.Migrate(store, dryRun)
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+		if dryRun {
+			log.Infof("migration %d (%s) would touch %d records", m.Version, m.Description, count)
+			continue
+		}
+		if err = store.PutSchemaVersion(m.Version); err != nil {
+			return err
+		}
+		log.Infof("migration %d (%s) touched %d records in %s", m.Version, m.Description, count, time.Since(start))
+	}
+	_, err = reencryptTokens(false, dryRun)
+	return err
+}
+
+// holdMigrationsLease waits until it acquires the migrations lease, returning a function to release it,
+// it's renewed until released, so that it's held however long the migrations take
+func holdMigrationsLease() (release func(), err error) {
+	buf := make([]byte, 8)
+	if _, err = rand.Read(buf); err != nil {
+		return nil, err
+	}
+	holder := hex.EncodeToString(buf)
+	for {
+		token, err := store.AcquireLease(migrationsLeaseName, holder, migrationsLeaseTTL)
+		if err != nil {
+			return nil, err
+		}
+		if token != 0 {
+			break
+		}
+		log.Info("waiting for another instance to finish migrating")
+		time.Sleep(time.Second)
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(migrationsLeaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// losing it is not fatal, as the migrations are idempotent and only put records which haven't changed
+				if token, err := store.AcquireLease(migrationsLeaseName, holder, migrationsLeaseTTL); err != nil {
+					log.Errorf("failed to renew migrations lease: %v", err)
+				} else if token == 0 {
+					log.Error("lost migrations lease, another instance may be migrating as well")
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+		if err := store.ReleaseLease(migrationsLeaseName, holder); err != nil {
+			log.Errorf("failed to release migrations lease: %v", err)
+		}
+	}, nil
+}
+
+// metaTokensKeyID is the name of the metadata of the ID of the key all stored OAuth tokens are encrypted with,
+// empty if some of them may be in plaintext
+const metaTokensKeyID = "tokens_key_id"
+
+// ReencryptTokens encrypts all stored OAuth tokens which are in plaintext or encrypted with a key other than the current one,
+// e.g., to make sure none is left on a rotated key before retiring it, returning the number of users touched
+// it holds the migrations lease like Migrate
+func ReencryptTokens() (int, error) {
+	if tokens == nil {
+		return 0, errors.New("no encryption key configured")
+	}
+	release, err := holdMigrationsLease()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return reencryptTokens(true, false)
+}
+
+// reencryptTokens encrypts the stored OAuth tokens with the current key if they may not all be encrypted with it,
+// i.e., a key has been configured, or the current one has changed, since the last time they were
+// it's driven by the configured keys rather than by the schema version, as they may change at any time
+// it fails if the tokens have been encrypted but no key is configured now, e.g., by mistake in a deploy
+// if `force` is true, it checks every user regardless
+func reencryptTokens(force, dryRun bool) (int, error) {
+	keyID, err := store.GetMeta(metaTokensKeyID)
+	if err != nil {
+		return 0, err
+	}
+	if tokens == nil {
+		if keyID != "" { // none of the stored tokens could be decrypted
+			return 0, fmt.Errorf("OAuth tokens are encrypted with key %q, but no encryption key is configured", keyID)
+		}
+		return 0, nil
+	}
+	if keyID == tokens.keyID && !force {
+		return 0, nil
+	}
+
+	start := time.Now()
+	count, err := migrateUsers(store, dryRun, func(u *User) (bool, error) {
+		if tokens.isCurrent(u.AccessToken) && tokens.isCurrent(u.RefreshToken) {
+			return false, nil
+		}
+		decrypted, err := decryptUserTokens(*u)
+		if err != nil {
+			return false, err
+		}
+		if *u, err = encryptUserTokens(decrypted); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+	if err != nil {
+		return count, fmt.Errorf("failed to encrypt OAuth tokens with key %q: %w", tokens.keyID, err)
+	}
+	if dryRun {
+		log.Infof("encrypting OAuth tokens with key %q would touch %d users", tokens.keyID, count)
+		return count, nil
+	}
+	log.Infof("encrypted OAuth tokens of %d users with key %q in %s", count, tokens.keyID, time.Since(start))
+	return count, store.PutMeta(metaTokensKeyID, tokens.keyID)
+}
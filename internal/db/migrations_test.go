@@ -0,0 +1,124 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	store = newMemoryStore()
+
+	if err := Migrate(true); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := store.GetSchemaVersion(); version != 0 {
+		t.Errorf("dry run: got schema version %d, want 0", version)
+	}
+
+	if err := Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := store.GetSchemaVersion(); version != SchemaVersion {
+		t.Errorf("got schema version %d, want %d", version, SchemaVersion)
+	}
+
+	_ = store.PutSchemaVersion(SchemaVersion + 1)
+	if err := Migrate(false); err == nil {
+		t.Error("newer schema version: got no error")
+	}
+}
+
+func TestMigrateReencryptTokens(t *testing.T) {
+	store = newMemoryStore()
+	defer func() { tokens = nil }()
+	keys := map[string]string{"1": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=", "2": "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="}
+	migrate := func(keyID string) {
+		t.Helper()
+		tokens = nil
+		if keyID != "" {
+			var err error
+			if tokens, err = newTokenCipher(keys, keyID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := Migrate(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the stored tokens of the given user are encrypted with the key with the given ID, in plaintext if empty
+	assertStored := func(userID int64, keyID string) {
+		t.Helper()
+		u, err := store.GetUser(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefix := "enc:" + keyID + ":"
+		if keyID == "" {
+			prefix = ""
+		}
+		if !strings.HasPrefix(u.AccessToken, prefix) || !strings.HasPrefix(u.RefreshToken, prefix) || (keyID == "" && u.AccessToken != "access") {
+			t.Errorf("user %d: got stored tokens %q and %q, want them encrypted with key %q", userID, u.AccessToken, u.RefreshToken, keyID)
+		}
+		if u, err = GetUser(userID); err != nil || u.AccessToken != "access" || u.RefreshToken != "refresh" {
+			t.Errorf("user %d: got tokens %q and %q, %v", userID, u.AccessToken, u.RefreshToken, err)
+		}
+	}
+
+	// tokens put before any key is configured are encrypted once one is, whenever it is
+	migrate("")
+	if err := PutUser(User{ID: 1, AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatal(err)
+	}
+	migrate("")
+	assertStored(1, "")
+	migrate("1")
+	assertStored(1, "1")
+
+	// and again after rotating the key, so the old one can be retired
+	migrate("2")
+	assertStored(1, "2")
+	delete(keys, "1")
+	migrate("2")
+	assertStored(1, "2")
+
+	// but the keys can't be unconfigured once tokens are encrypted
+	tokens = nil
+	if err := Migrate(false); err == nil {
+		t.Error("no key configured for encrypted tokens: got no error")
+	}
+
+	// tokens put in plaintext (e.g., by an older build) are encrypted by ReencryptTokens
+	if err := PutUser(User{ID: 2, AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatal(err)
+	}
+	tokens, _ = newTokenCipher(keys, "2")
+	if count, err := ReencryptTokens(); err != nil || count != 1 {
+		t.Errorf("ReencryptTokens: got %d, %v, want 1", count, err)
+	}
+	assertStored(2, "2")
+}
+
+func TestMigrateUserChangedMeanwhile(t *testing.T) {
+	store = newMemoryStore()
+	if err := store.PutUser(User{ID: 1, AccessToken: "old", LanguageCode: "ca"}); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	changed, err := migrateUser(store, 1, false, func(u *User) (bool, error) {
+		calls++
+		if calls == 1 { // the user's token is refreshed by another instance meanwhile
+			if err := store.PutUser(User{ID: 1, AccessToken: "refreshed", LanguageCode: "ca"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		u.LanguageCode = "en"
+		return true, nil
+	})
+	if err != nil || !changed || calls != 2 {
+		t.Errorf("got %t, %v after %d calls, want true, nil after 2", changed, err, calls)
+	}
+	if u, _ := store.GetUser(1); u.AccessToken != "refreshed" || u.LanguageCode != "en" {
+		t.Errorf("got user %+v, want the refreshed token kept", u)
+	}
+}
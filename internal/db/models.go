@@ -1,6 +1,9 @@
 package db
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+)
 
 // LoginSession represents a session of login (FIB API OAuth authorization) procedure
 type LoginSession struct {
@@ -12,18 +15,128 @@ type LoginSession struct {
 
 // User represents a user's data
 type User struct {
-	ID                  int64  `json:"-"`
-	TokenExpiry         int64  `json:"e"`
-	AccessToken         string `json:"a"`
-	RefreshToken        string `json:"r"`
-	LanguageCode        string `json:"l,omitempty"`
-	LastNoticeTimestamp int64  `json:"t,omitempty"`
-	MuteBannerNotices   bool   `json:"i,omitempty"`
+	ID                   int64                 `json:"-"`
+	TokenExpiry          int64                 `json:"e"`
+	AccessToken          string                `json:"a"`
+	RefreshToken         string                `json:"r"`
+	LanguageCode         string                `json:"l,omitempty"`
+	LastNoticeTimestamp  int64                 `json:"t,omitempty"` // Deprecated: only read for seeding the seen notices
+	MuteBannerNotices    bool                  `json:"i,omitempty"`
+	DailySchedule        bool                  `json:"s,omitempty"`
+	ClassReminderMinutes uint16                `json:"m,omitempty"`
+	CalendarToken        string                `json:"k,omitempty"`
+	MutedExamSubjects    []string              `json:"x,omitempty"`
+	SubjectNoticeModes   map[string]NoticeMode `json:"n,omitempty"` // by subject code, NoticeModeDeliver if absent
+	SeenNoticesSeeded    bool                  `json:"v,omitempty"`
+	InactiveSince        int64                 `json:"d,omitempty"` // since when the user has blocked the bot or deleted their account
+}
+
+// NoticeMode represents how the notices of a subject are delivered to a user
+type NoticeMode uint8
+
+// notice modes
+const (
+	NoticeModeDeliver NoticeMode = iota
+	NoticeModeDeliverSilently
+	NoticeModeDrop
+)
+
+// NoticeModeOf returns the user's notice mode of the subject with the given code
+func (u *User) NoticeModeOf(subjectCode string) NoticeMode {
+	return u.SubjectNoticeModes[subjectCode]
+}
+
+// ReminderType represents the type of a Reminder
+type ReminderType uint8
+
+// reminder types
+const (
+	ClassReminder ReminderType = iota + 1
+	ExamReminder
+)
+
+// Reminder represents a message scheduled to be sent to a user at a later time
+type Reminder struct {
+	ID          string       `json:"-"`
+	UserID      int64        `json:"u"`
+	Type        ReminderType `json:"k"`
+	SubjectCode string       `json:"s"`
+	Group       string       `json:"g,omitempty"`
+	Types       string       `json:"y,omitempty"`
+	Classrooms  string       `json:"c,omitempty"`
+	StartsAt    int64        `json:"t"`
+}
+
+// MaxAlertRules is the maximum number of alert rules a user can have
+const MaxAlertRules = 10
+
+// AlertRule represents a user-defined rule for notices whose title or text match its pattern
+type AlertRule struct {
+	Pattern         string `json:"p"` // regular expression in RE2 syntax
+	CaseInsensitive bool   `json:"i,omitempty"`
+	Loud            bool   `json:"l,omitempty"` // always deliver with notification, overriding the notice modes
+	Pin             bool   `json:"n,omitempty"`
+	Prefix          string `json:"x,omitempty"`
+}
+
+// KnownExam represents the last known state of an exam of a user, for detecting changes between polls
+type KnownExam struct {
+	StartsAt   int64   `json:"t"`
+	EndsAt     int64   `json:"f"`
+	Classrooms string  `json:"c,omitempty"`
+	Reminders  []int64 `json:"r,omitempty"` // offsets (in seconds before it starts) its reminders have been scheduled at
+}
+
+// DeliveredNotice represents a notice which has been seen by (delivered to) a user, for telling whether it's new
+// or modified, editing its message and telling what has changed when it's modified
+type DeliveredNotice struct {
+	MessageID int    `json:"m"`           // Telegram message ID, 0 if it hasn't been sent (e.g., dropped)
+	Version   int64  `json:"v,omitempty"` // the notice's publish (latest of creation and modification) timestamp
+	ExpiresAt int64  `json:"x"`           // the notice's expiration timestamp, after which it can be forgotten
+	Hash      string `json:"h,omitempty"` // hash of the delivered content, whose NoticeSnapshot is shared by all users
+}
+
+// NoticeSnapshot represents the content of a version of a notice as delivered, stored once per notice and hash
+// (instead of per user) for telling what has changed when it's modified
+type NoticeSnapshot struct {
+	Hash        string   `json:"-"`
+	Title       string   `json:"t,omitempty"`
+	Text        string   `json:"b,omitempty"` // plain text without HTML tags
+	Attachments []string `json:"a,omitempty"` // sorted attachment names
+}
+
+// NoticesValidators represents the validators of a user's last fetched notices (a FIB API response),
+// for fetching them only if they have changed since
+type NoticesValidators struct {
+	ETag         string `json:"e,omitempty"`
+	LastModified string `json:"m,omitempty"`
+	Size         int    `json:"s,omitempty"` // of the response body
+}
+
+// OutboundNotice represents a notice queued to be delivered to a user
+type OutboundNotice struct {
+	ID        string          `json:"i"`
+	UserID    int64           `json:"u"`
+	Notice    json.RawMessage `json:"n"` // fibapi.Notice in JSON
+	Attempts  uint8           `json:"r,omitempty"`
+	LastError string          `json:"e,omitempty"`
+	FailedAt  int64           `json:"f,omitempty"` // timestamp of the last failed attempt
+}
+
+// Fence represents a term of a lease, whose token is returned by AcquireLease when the term begins,
+// writes fenced by it fail with ErrFenced once another term has begun, i.e., the lease has been taken over
+// the zero value fences nothing
+type Fence struct {
+	Lease string
+	Token int64
 }
 
 // errors
 var (
-	ErrLoginSessionNotFound = errors.New("db: login session not found")
-	ErrUserNotFound         = errors.New("db: user not found")
-	ErrSubjectNotFound      = errors.New("db: subject not found")
+	ErrLoginSessionNotFound   = errors.New("db: login session not found")
+	ErrUserNotFound           = errors.New("db: user not found")
+	ErrSubjectNotFound        = errors.New("db: subject not found")
+	ErrCalendarTokenNotFound  = errors.New("db: calendar token not found")
+	ErrNoticeSnapshotNotFound = errors.New("db: notice snapshot not found")
+	ErrFenced                 = errors.New("db: write fenced off, as a newer term of the lease has begun")
 )
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxDeadLetters is the max number of dead letters kept, older ones are discarded
+const maxDeadLetters = 1000
+
+// claimDueOutboundNoticesScript atomically claims at most ARGV[2] outbound notices with next attempt timestamps
+// up to ARGV[1], by postponing them to ARGV[3], returning them as a flat list of IDs and data
+// claimed notices are attempted again after the postponement if their claimer fails to ack them (e.g., crashed)
+var claimDueOutboundNoticesScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+if #ids == 0 then
+	return {}
+end
+local values = redis.call('HMGET', KEYS[2], unpack(ids))
+local res = {}
+for i, id in ipairs(ids) do
+	if values[i] then
+		redis.call('ZADD', KEYS[1], ARGV[3], id)
+		table.insert(res, id)
+		table.insert(res, values[i])
+	else
+		redis.call('ZREM', KEYS[1], id)
+	end
+end
+return res
+`)
+
+// NewOutboundNotice makes an OutboundNotice of the given notice (in JSON) to a user with the given ID,
+// its ID is unique for each version of the notice, i.e., by its ID and publish timestamp
+func NewOutboundNotice(userID int64, noticeID int32, publishedAt int64, notice json.RawMessage) OutboundNotice {
+	return OutboundNotice{
+		ID:     fmt.Sprintf("%d:%d:%d", userID, noticeID, publishedAt),
+		UserID: userID,
+		Notice: notice,
+	}
+}
+
+// EnqueueOutboundNotice queues the given outbound notice to be delivered as soon as possible, fenced by the given fence
+// it returns false if a notice with the same ID is already queued, which is left untouched
+func (rs *redisStore) EnqueueOutboundNotice(n OutboundNotice, fence Fence) (bool, error) {
+	value, err := json.Marshal(n)
+	if err != nil {
+		return false, err
+	}
+	var added *redis.BoolCmd
+	err = rs.fenced(fence, func(pipe redis.Pipeliner) error {
+		added = pipe.HSetNX(ctx, keyOutboxData, n.ID, value)
+		pipe.ZAddNX(ctx, keyOutbox, redis.Z{Score: float64(time.Now().Unix()), Member: n.ID})
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return added.Val(), nil
+}
+
+// ClaimDueOutboundNotices claims at most `count` outbound notices which are due at the given time,
+// each of them must be acked by AckOutboundNotice, RetryOutboundNotice or DeadLetterOutboundNotice before `lease` passes,
+// otherwise it will be claimed again
+func (rs *redisStore) ClaimDueOutboundNotices(now time.Time, count int64, lease time.Duration) ([]OutboundNotice, error) {
+	values, err := claimDueOutboundNoticesScript.Run(ctx, rs.rdb,
+		[]string{keyOutbox, keyOutboxData},
+		strconv.FormatInt(now.Unix(), 10), count, strconv.FormatInt(now.Add(lease).Unix(), 10)).StringSlice()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			err = nil
+		}
+		return nil, err
+	}
+
+	notices := make([]OutboundNotice, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		var n OutboundNotice
+		if err = json.Unmarshal([]byte(values[i+1]), &n); err != nil {
+			log.Errorf("failed to parse outbound notice %s: %v", values[i], err)
+			continue
+		}
+		n.ID = values[i]
+		notices = append(notices, n)
+	}
+	return notices, nil
+}
+
+// AckOutboundNotice deletes the outbound notice with the given ID from the queue, after it has been delivered
+func (rs *redisStore) AckOutboundNotice(ID string) error {
+	_, err := rs.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, keyOutbox, ID)
+		pipe.HDel(ctx, keyOutboxData, ID)
+		return nil
+	})
+	return err
+}
+
+// RetryOutboundNotice puts the given outbound notice (with its attempts updated) back to the queue,
+// to be attempted again at the given time
+func (rs *redisStore) RetryOutboundNotice(n OutboundNotice, at time.Time) error {
+	value, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	_, err = rs.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, keyOutboxData, n.ID, value)
+		pipe.ZAdd(ctx, keyOutbox, redis.Z{Score: float64(at.Unix()), Member: n.ID})
+		return nil
+	})
+	return err
+}
+
+// DeadLetterOutboundNotice moves the given outbound notice from the queue to the dead letters
+func (rs *redisStore) DeadLetterOutboundNotice(n OutboundNotice) error {
+	value, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	_, err = rs.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, keyOutbox, n.ID)
+		pipe.HDel(ctx, keyOutboxData, n.ID)
+		pipe.LPush(ctx, keyDeadLetters, value)
+		pipe.LTrim(ctx, keyDeadLetters, 0, maxDeadLetters-1)
+		return nil
+	})
+	return err
+}
+
+// GetDeadLetters gets at most `count` latest dead letters, along with the total number of them
+func (rs *redisStore) GetDeadLetters(count int64) ([]OutboundNotice, int64, error) {
+	var values *redis.StringSliceCmd
+	var total *redis.IntCmd
+	_, err := rs.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.LRange(ctx, keyDeadLetters, 0, count-1)
+		total = pipe.LLen(ctx, keyDeadLetters)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	notices := make([]OutboundNotice, 0, len(values.Val()))
+	for _, value := range values.Val() {
+		var n OutboundNotice
+		if err = json.Unmarshal([]byte(value), &n); err != nil {
+			return nil, 0, err
+		}
+		notices = append(notices, n)
+	}
+	return notices, total.Val(), nil
+}
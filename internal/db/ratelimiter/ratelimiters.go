@@ -4,16 +4,15 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/go-redis/redis_rate/v10"
-
 	"RacoBot/internal/db"
 )
 
 // limits
 var (
-	limitBotUpdate            = redis_rate.PerSecond(2)
-	limitOAuthRedirectRequest = redis_rate.PerMinute(3)
-	limitLoginCommand         = redis_rate.PerMinute(3)
+	limitBotUpdate            = db.PerSecond(2)
+	limitOAuthRedirectRequest = db.PerMinute(3)
+	limitLoginCommand         = db.PerMinute(3)
+	limitCalendarFeedRequest  = db.PerMinute(10)
 )
 
 // limit key prefixes
@@ -21,34 +20,45 @@ const (
 	keyPrefixBotUpdate            = "b"
 	keyPrefixOAuthRedirectRequest = "o"
 	keyPrefixLoginCommand         = "l"
+	keyPrefixCalendarFeedRequest  = "c"
 )
 
 // BotUpdateAllowed checks if an incoming Bot Update from a user with the given ID is allowed to get processed
 func BotUpdateAllowed(ctx context.Context, userID int64) bool {
 	key := fmt.Sprintf("%s:%d", keyPrefixBotUpdate, userID)
-	res, err := db.RateLimiter.Allow(ctx, key, limitBotUpdate)
+	allowed, err := db.Allow(ctx, key, limitBotUpdate)
 	if err != nil {
 		panic(err)
 	}
-	return res.Allowed != 0
+	return allowed
 }
 
 // OAuthRedirectRequestAllowed checks if an incoming OAuth redirect request from the given IP address is allowed to get processed
 func OAuthRedirectRequestAllowed(ctx context.Context, IP string) bool {
 	key := fmt.Sprintf("%s:%s", keyPrefixOAuthRedirectRequest, IP)
-	res, err := db.RateLimiter.Allow(ctx, key, limitOAuthRedirectRequest)
+	allowed, err := db.Allow(ctx, key, limitOAuthRedirectRequest)
 	if err != nil {
 		panic(err)
 	}
-	return res.Allowed != 0
+	return allowed
 }
 
 // LoginCommandAllowed checks if an incoming /login command from a user with the given ID is allowed to get processed
 func LoginCommandAllowed(userID int64) bool {
 	key := fmt.Sprintf("%s:%d", keyPrefixLoginCommand, userID)
-	res, err := db.RateLimiter.Allow(context.Background(), key, limitLoginCommand)
+	allowed, err := db.Allow(context.Background(), key, limitLoginCommand)
+	if err != nil {
+		panic(err)
+	}
+	return allowed
+}
+
+// CalendarFeedRequestAllowed checks if an incoming calendar feed request from the given IP address is allowed to get processed
+func CalendarFeedRequestAllowed(ctx context.Context, IP string) bool {
+	key := fmt.Sprintf("%s:%s", keyPrefixCalendarFeedRequest, IP)
+	allowed, err := db.Allow(ctx, key, limitCalendarFeedRequest)
 	if err != nil {
 		panic(err)
 	}
-	return res.Allowed != 0
+	return allowed
 }
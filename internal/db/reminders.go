@@ -0,0 +1,80 @@
+package db
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// popDueRemindersScript atomically pops at most ARGV[2] reminders with due timestamps up to ARGV[1],
+// returning them as a flat list of IDs and data
+var popDueRemindersScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+if #ids == 0 then
+	return {}
+end
+redis.call('ZREM', KEYS[1], unpack(ids))
+local values = redis.call('HMGET', KEYS[2], unpack(ids))
+redis.call('HDEL', KEYS[2], unpack(ids))
+local res = {}
+for i, id in ipairs(ids) do
+	if values[i] then
+		table.insert(res, id)
+		table.insert(res, values[i])
+	end
+end
+return res
+`)
+
+// PutReminder puts the given reminder to be due at the given time, fenced by the given fence
+// putting a reminder with an existing ID replaces it and reschedules it
+func (rs *redisStore) PutReminder(r Reminder, dueAt time.Time, fence Fence) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return rs.fenced(fence, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, keyReminderData, r.ID, value)
+		pipe.ZAdd(ctx, keyReminders, redis.Z{Score: float64(dueAt.Unix()), Member: r.ID})
+		return nil
+	})
+}
+
+// DelReminder deletes a reminder with the given ID
+func (rs *redisStore) DelReminder(ID string) error {
+	_, err := rs.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, keyReminders, ID)
+		pipe.HDel(ctx, keyReminderData, ID)
+		return nil
+	})
+	return err
+}
+
+// PopDueReminders pops at most `count` reminders which are due at the given time
+// popped reminders are deleted, so each of them is only returned once even with multiple callers
+func (rs *redisStore) PopDueReminders(now time.Time, count int64) ([]Reminder, error) {
+	values, err := popDueRemindersScript.Run(ctx, rs.rdb,
+		[]string{keyReminders, keyReminderData},
+		strconv.FormatInt(now.Unix(), 10), count).StringSlice()
+	if err != nil {
+		if err == redis.Nil {
+			err = nil
+		}
+		return nil, err
+	}
+
+	reminders := make([]Reminder, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		var r Reminder
+		if err = json.Unmarshal([]byte(values[i+1]), &r); err != nil {
+			log.Errorf("failed to parse reminder %s: %v", values[i], err)
+			continue
+		}
+		r.ID = values[i]
+		reminders = append(reminders, r)
+	}
+	return reminders, nil
+}
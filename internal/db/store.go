@@ -0,0 +1,353 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Store represents a storage backend of the bot's data
+// the package-level functions delegate to the Store chosen in Init
+type Store interface {
+	// login sessions
+	GetLoginSession(state string) (LoginSession, error)
+	PutLoginSession(s LoginSession) error
+	DelLoginSession(state string) error
+
+	// users and their data
+	GetUser(userID int64) (User, error)
+	PutUser(user User) error
+	CompareAndPutUser(old, user User) (bool, error)
+	DelUser(userID int64) error
+	ScanUserIDs(cursor string, count int64) ([]int64, string, error)
+	ReplaceCalendarToken(user User, oldToken string) error
+	GetCalendarTokenUserID(token string) (int64, error)
+	GetKnownExams(userID int64) (map[int32]KnownExam, error)
+	PutKnownExams(userID int64, exams map[int32]KnownExam) error
+	GetAlertRules(userID int64) ([]AlertRule, error)
+	PutAlertRules(userID int64, rules []AlertRule) error
+	GetDeliveredNotices(userID int64) (map[int32]DeliveredNotice, error)
+	PutDeliveredNotice(userID int64, noticeID int32, n DeliveredNotice) error
+	PutDeliveredNotices(userID int64, notices map[int32]DeliveredNotice) error
+	DelDeliveredNotices(userID int64, noticeIDs ...int32) error
+	GetNoticeSnapshot(noticeID int32, hash string) (NoticeSnapshot, error)
+	PutNoticeSnapshot(noticeID int32, s NoticeSnapshot, expiresAt int64) error
+	GetNoticesValidators(userID int64) (NoticesValidators, error)
+	PutNoticesValidators(userID int64, v NoticesValidators) error
+
+	// subject codes
+	GetSubjectUPCCode(acronym string) (uint32, error)
+	GetAllSubjectUPCCodes() (map[string]uint32, error)
+	PutSubjectUPCCode(acronym string, code uint32) error
+	PutSubjectUPCCodes(codes map[string]uint32) error
+	DelAllSubjectUPCCodes() error
+
+	// rate limits
+	Allow(ctx context.Context, key string, limit Limit) (bool, error)
+
+	// reminders and outbound notices queues
+	PutReminder(r Reminder, dueAt time.Time, fence Fence) error
+	DelReminder(ID string) error
+	PopDueReminders(now time.Time, count int64) ([]Reminder, error)
+	EnqueueOutboundNotice(n OutboundNotice, fence Fence) (bool, error)
+	ClaimDueOutboundNotices(now time.Time, count int64, lease time.Duration) ([]OutboundNotice, error)
+	AckOutboundNotice(ID string) error
+	RetryOutboundNotice(n OutboundNotice, at time.Time) error
+	DeadLetterOutboundNotice(n OutboundNotice) error
+	GetDeadLetters(count int64) ([]OutboundNotice, int64, error)
+
+	// schema version and metadata
+	GetSchemaVersion() (int, error)
+	PutSchemaVersion(version int) error
+	GetMeta(name string) (string, error)
+	PutMeta(name, value string) error
+
+	// leases
+	AcquireLease(name, holder string, ttl time.Duration) (int64, error)
+	ReleaseLease(name, holder string) error
+
+	String() string
+	Close() error
+}
+
+// Limit represents a rate limit of `Rate` events per `Period`, with bursts of up to `Rate` events
+type Limit struct {
+	Rate   int
+	Period time.Duration
+}
+
+// PerSecond returns a Limit of the given number of events per second
+func PerSecond(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Second}
+}
+
+// PerMinute returns a Limit of the given number of events per minute
+func PerMinute(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Minute}
+}
+
+// GetLoginSession gets a login session with the given state
+func GetLoginSession(state string) (LoginSession, error) {
+	return store.GetLoginSession(state)
+}
+
+// PutLoginSession puts the given login session
+func PutLoginSession(s LoginSession) error {
+	return store.PutLoginSession(s)
+}
+
+// DelLoginSession deletes a login session with the given state
+func DelLoginSession(state string) error {
+	return store.DelLoginSession(state)
+}
+
+// GetUser gets a user with the given ID
+func GetUser(userID int64) (User, error) {
+	user, err := store.GetUser(userID)
+	if err != nil {
+		return User{}, err
+	}
+	return decryptUserTokens(user)
+}
+
+// PutUser puts the given user, with their OAuth tokens encrypted if enabled
+func PutUser(user User) error {
+	user, err := encryptUserTokens(user)
+	if err != nil {
+		return err
+	}
+	return store.PutUser(user)
+}
+
+// DelUser deletes a user with the given ID, along with their calendar token, known exams, alert rules and delivered notices
+func DelUser(userID int64) error {
+	return store.DelUser(userID)
+}
+
+// userIDsPageSize is the number of user IDs fetched at once when iterating over all users
+const userIDsPageSize = 500
+
+// UserIDIterator iterates over all user IDs page by page, in no particular order
+// users put or deleted during the iteration may or may not be visited, but no user is visited twice
+type UserIDIterator struct {
+	page   []int64
+	cursor string
+	done   bool
+	seen   map[int64]struct{}
+	userID int64
+	err    error
+}
+
+// NewUserIDIterator makes a UserIDIterator starting from the first user
+func NewUserIDIterator() *UserIDIterator {
+	return &UserIDIterator{seen: make(map[int64]struct{})}
+}
+
+// Next advances the iterator to the next user ID, it returns false when there are no more or an error occurs
+func (it *UserIDIterator) Next() bool {
+	for it.err == nil {
+		for len(it.page) > 0 {
+			it.userID, it.page = it.page[0], it.page[1:]
+			if _, ok := it.seen[it.userID]; !ok { // pages may overlap
+				it.seen[it.userID] = struct{}{}
+				return true
+			}
+		}
+		if it.done {
+			return false
+		}
+		it.page, it.cursor, it.err = store.ScanUserIDs(it.cursor, userIDsPageSize)
+		it.done = it.cursor == ""
+	}
+	return false
+}
+
+// UserID returns the current user ID
+func (it *UserIDIterator) UserID() int64 {
+	return it.userID
+}
+
+// Err returns the error occurred during the iteration, if any
+func (it *UserIDIterator) Err() error {
+	return it.err
+}
+
+// GetCalendarTokenUserID gets the ID of the user who owns the given calendar feed token
+func GetCalendarTokenUserID(token string) (int64, error) {
+	return store.GetCalendarTokenUserID(token)
+}
+
+// GetKnownExams gets the last known states of the exams of a user with the given ID, by exam ID
+func GetKnownExams(userID int64) (map[int32]KnownExam, error) {
+	return store.GetKnownExams(userID)
+}
+
+// PutKnownExams replaces the last known states of the exams of a user with the given ID
+func PutKnownExams(userID int64, exams map[int32]KnownExam) error {
+	return store.PutKnownExams(userID, exams)
+}
+
+// GetAlertRules gets the alert rules of a user with the given ID
+func GetAlertRules(userID int64) ([]AlertRule, error) {
+	return store.GetAlertRules(userID)
+}
+
+// PutAlertRules replaces the alert rules of a user with the given ID
+func PutAlertRules(userID int64, rules []AlertRule) error {
+	return store.PutAlertRules(userID, rules)
+}
+
+// GetDeliveredNotices gets the notices delivered to a user with the given ID, by notice ID
+func GetDeliveredNotices(userID int64) (map[int32]DeliveredNotice, error) {
+	return store.GetDeliveredNotices(userID)
+}
+
+// PutDeliveredNotice puts the given delivered notice with the given ID of a user with the given ID
+func PutDeliveredNotice(userID int64, noticeID int32, n DeliveredNotice) error {
+	return store.PutDeliveredNotice(userID, noticeID, n)
+}
+
+// PutDeliveredNotices puts the given delivered notices (by notice ID) of a user with the given ID in bulk
+func PutDeliveredNotices(userID int64, notices map[int32]DeliveredNotice) error {
+	return store.PutDeliveredNotices(userID, notices)
+}
+
+// DelDeliveredNotices deletes the delivered notices with the given IDs of a user with the given ID
+func DelDeliveredNotices(userID int64, noticeIDs ...int32) error {
+	return store.DelDeliveredNotices(userID, noticeIDs...)
+}
+
+// GetNoticeSnapshot gets the snapshot with the given hash of a notice with the given ID
+func GetNoticeSnapshot(noticeID int32, hash string) (NoticeSnapshot, error) {
+	return store.GetNoticeSnapshot(noticeID, hash)
+}
+
+// PutNoticeSnapshot puts the given snapshot of a notice with the given ID,
+// which is kept until a while after the notice's expiration timestamp
+func PutNoticeSnapshot(noticeID int32, s NoticeSnapshot, expiresAt int64) error {
+	return store.PutNoticeSnapshot(noticeID, s, expiresAt)
+}
+
+// GetNoticesValidators gets the validators of the last fetched notices of a user with the given ID,
+// zero if there are none
+func GetNoticesValidators(userID int64) (NoticesValidators, error) {
+	return store.GetNoticesValidators(userID)
+}
+
+// PutNoticesValidators replaces the validators of the last fetched notices of a user with the given ID
+func PutNoticesValidators(userID int64, v NoticesValidators) error {
+	return store.PutNoticesValidators(userID, v)
+}
+
+// GetSubjectUPCCode gets the UPC code of a subject with the given acronym
+func GetSubjectUPCCode(acronym string) (uint32, error) {
+	return store.GetSubjectUPCCode(acronym)
+}
+
+// PutSubjectUPCCode puts the given UPC code of a subject with the given acronym
+func PutSubjectUPCCode(acronym string, code uint32) error {
+	return store.PutSubjectUPCCode(acronym, code)
+}
+
+// PutSubjectUPCCodes puts the given subject UPC codes in bulk
+func PutSubjectUPCCodes(codes map[string]uint32) error {
+	return store.PutSubjectUPCCodes(codes)
+}
+
+// DelAllSubjectUPCCodes deletes all subject UPC codes
+func DelAllSubjectUPCCodes() error {
+	return store.DelAllSubjectUPCCodes()
+}
+
+// Allow checks if an event with the given key is allowed under the given limit, and counts it if so
+func Allow(ctx context.Context, key string, limit Limit) (bool, error) {
+	return store.Allow(ctx, key, limit)
+}
+
+// PutReminder puts the given reminder to be due at the given time, fenced by the given fence
+// putting a reminder with an existing ID replaces it and reschedules it
+func PutReminder(r Reminder, dueAt time.Time, fence Fence) error {
+	return store.PutReminder(r, dueAt, fence)
+}
+
+// DelReminder deletes a reminder with the given ID
+func DelReminder(ID string) error {
+	return store.DelReminder(ID)
+}
+
+// PopDueReminders pops at most `count` reminders which are due at the given time
+// popped reminders are deleted, so each of them is only returned once even with multiple callers
+func PopDueReminders(now time.Time, count int64) ([]Reminder, error) {
+	return store.PopDueReminders(now, count)
+}
+
+// EnqueueOutboundNotice queues the given outbound notice to be delivered as soon as possible, fenced by the given fence
+// it returns false if a notice with the same ID is already queued, which is left untouched
+func EnqueueOutboundNotice(n OutboundNotice, fence Fence) (bool, error) {
+	return store.EnqueueOutboundNotice(n, fence)
+}
+
+// ClaimDueOutboundNotices claims at most `count` outbound notices which are due at the given time,
+// each of them must be acked by AckOutboundNotice, RetryOutboundNotice or DeadLetterOutboundNotice before `lease` passes,
+// otherwise it will be claimed again
+func ClaimDueOutboundNotices(now time.Time, count int64, lease time.Duration) ([]OutboundNotice, error) {
+	return store.ClaimDueOutboundNotices(now, count, lease)
+}
+
+// AckOutboundNotice deletes the outbound notice with the given ID from the queue, after it has been delivered
+func AckOutboundNotice(ID string) error {
+	return store.AckOutboundNotice(ID)
+}
+
+// RetryOutboundNotice puts the given outbound notice (with its attempts updated) back to the queue,
+// to be attempted again at the given time
+func RetryOutboundNotice(n OutboundNotice, at time.Time) error {
+	return store.RetryOutboundNotice(n, at)
+}
+
+// DeadLetterOutboundNotice moves the given outbound notice from the queue to the dead letters
+func DeadLetterOutboundNotice(n OutboundNotice) error {
+	return store.DeadLetterOutboundNotice(n)
+}
+
+// GetDeadLetters gets at most `count` latest dead letters, along with the total number of them
+func GetDeadLetters(count int64) ([]OutboundNotice, int64, error) {
+	return store.GetDeadLetters(count)
+}
+
+// GetMeta gets the metadata value with the given name, empty if it has never been set
+func GetMeta(name string) (string, error) {
+	return store.GetMeta(name)
+}
+
+// PutMeta puts the metadata value with the given name
+func PutMeta(name, value string) error {
+	return store.PutMeta(name, value)
+}
+
+// AcquireLease acquires the lease with the given name for the given holder for the given TTL,
+// or renews it if it's already held by the holder
+// it returns the fencing token of the holder's term if the holder holds the lease afterwards, 0 otherwise,
+// tokens increase with each new term, see Fence
+func AcquireLease(name, holder string, ttl time.Duration) (int64, error) {
+	return store.AcquireLease(name, holder, ttl)
+}
+
+// ReleaseLease releases the lease with the given name if it's held by the given holder
+func ReleaseLease(name, holder string) error {
+	return store.ReleaseLease(name, holder)
+}
+
+// fenceContextKey is the key of the Fence in a context, see ContextWithFence
+type fenceContextKey struct{}
+
+// ContextWithFence returns a copy of the given context carrying the given fence,
+// for the writes made on behalf of the context's holder to be fenced by it
+func ContextWithFence(ctx context.Context, fence Fence) context.Context {
+	return context.WithValue(ctx, fenceContextKey{}, fence)
+}
+
+// FenceFromContext returns the fence carried by the given context, the zero value if none
+func FenceFromContext(ctx context.Context) Fence {
+	fence, _ := ctx.Value(fenceContextKey{}).(Fence)
+	return fence
+}
@@ -3,10 +3,12 @@ package internal
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	tb "gopkg.in/telebot.v3"
@@ -136,7 +138,7 @@ func HandleOAuthRedirect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, userInfo, err := fibapi.Authorize(code)
+	token, userInfo, err := fibapi.AuthorizeContext(r.Context(), code)
 	if err != nil {
 		logger := log.WithFields(log.Fields{
 			"IP":    r.RemoteAddr,
@@ -217,6 +219,63 @@ func HandleMailtoLinkRedirect(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, string(link), http.StatusFound)
 }
 
+// HandleCalendarFeed handles an incoming iCalendar feed request of a user's class schedule
+func HandleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if len(token) != db.CalendarTokenHexEncodedLength {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if !rl.CalendarFeedRequestAllowed(r.Context(), r.RemoteAddr) {
+		log.WithFields(log.Fields{
+			"IP": r.RemoteAddr,
+		}).Info("rate limited")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintln(w, RateLimitedResponseBody)
+		return
+	}
+
+	userID, err := db.GetCalendarTokenUserID(token)
+	if err != nil {
+		if err != db.ErrCalendarTokenNotFound {
+			log.Errorf("failed to get calendar token user ID: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintln(w, InternalErrorResponseBody)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	client := bot.NewClientContext(r.Context(), userID)
+	if client == nil || client.User.CalendarToken != token { // user logged-out or token rotated
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	classes, err := client.GetSchedule()
+	if err != nil {
+		log.WithField("UID", userID).Errorf("failed to get schedule: %v", err)
+		if errors.Is(err, fibapi.ErrAuthorizationExpired) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		return
+	}
+
+	feed := bot.CalendarFeed{Classes: classes, UserID: userID, Now: time.Now()}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="raco.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	fmt.Fprint(w, feed.String())
+}
+
 // Middleware provides some useful middlewares for the server
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
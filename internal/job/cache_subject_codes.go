@@ -1,6 +1,7 @@
 package job
 
 import (
+	"context"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -10,11 +11,11 @@ import (
 )
 
 // CacheSubjectCodes pulls all subject UPC codes from public FIB API and stores them in the database
-func CacheSubjectCodes() {
+func CacheSubjectCodes(ctx context.Context) {
 	logger := log.WithField("job", "CacheSubjectCodes")
 
 	start := time.Now()
-	subjects, err := fibapi.GetPublicSubjects()
+	subjects, err := fibapi.GetPublicSubjectsContext(ctx)
 	if err != nil {
 		logger.Errorf("failed to get subjects: %v", err)
 		return
@@ -1,53 +1,230 @@
 package job
 
 import (
+	"context"
 	"time"
 
 	"github.com/go-co-op/gocron"
 	log "github.com/sirupsen/logrus"
+
+	"RacoBot/internal/bot"
+	"RacoBot/pkg/fibapi"
 )
 
 // Config represents a configuration for the jobs
 type Config struct {
-	PushNewNoticesCronExp    string `toml:"push_new_notices_cron"`
-	CacheSubjectCodesCronExp string `toml:"cache_subject_codes_cron"`
+	PushNewNoticesCronExp         string   `toml:"push_new_notices_cron"`
+	NoticePollingWorkers          int      `toml:"notice_polling_workers,omitempty"`
+	CacheSubjectCodesCronExp      string   `toml:"cache_subject_codes_cron"`
+	PushDailyScheduleCronExp      string   `toml:"push_daily_schedule_cron"`
+	ScheduleClassRemindersCronExp string   `toml:"schedule_class_reminders_cron"`
+	ScheduleExamRemindersCronExp  string   `toml:"schedule_exam_reminders_cron"`
+	ExamReminderOffsets           []string `toml:"exam_reminder_offsets,omitempty"` // durations before each exam, e.g., `24h`
+	PruneSubjectSettingsCronExp   string   `toml:"prune_subject_settings_cron"`
+	RevokeInactiveUsersCronExp    string   `toml:"revoke_inactive_users_cron"`
+	InactiveUserGracePeriod       string   `toml:"inactive_user_grace_period,omitempty"` // e.g., `720h`
+	LeaderLeaseTTL                string   `toml:"leader_lease_ttl,omitempty"`           // e.g., `30s`
 }
 
-var scheduler *gocron.Scheduler
+// defaultExamReminderOffsets are the offsets before each exam to send reminders at, if not configured
+var defaultExamReminderOffsets = []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, 2 * time.Hour}
+
+// defaultNoticePollingWorkers is the number of users whose new notices are checked concurrently, if not configured
+const defaultNoticePollingWorkers = 4
+
+// defaultInactiveUserGracePeriod is how long an inactive user is kept before their FIB API token is revoked, if not configured
+const defaultInactiveUserGracePeriod = 30 * 24 * time.Hour
+
+var (
+	scheduler               *gocron.Scheduler
+	tzMadrid                *time.Location
+	examReminderOffsets     []time.Duration
+	inactiveUserGracePeriod time.Duration
+	noticePollingWorkers    int
+
+	// ctx is the context of FIB API requests made by the jobs, cancelled when they stop
+	ctx, cancelJobs = context.WithCancel(context.Background())
+)
 
 // Init initializes the jobs scheduler
+// with multiple instances running against the same DB, only the one holding the leader lease runs the scheduled jobs,
+// while the reminder and outbox dispatchers run on every instance since they claim their work atomically
 func Init(config Config) {
-	tzMadrid, err := time.LoadLocation("Europe/Madrid")
+	var err error
+	tzMadrid, err = time.LoadLocation("Europe/Madrid")
 	if err != nil {
 		panic(err)
 	}
 
+	examReminderOffsets = defaultExamReminderOffsets
+	if len(config.ExamReminderOffsets) > 0 {
+		examReminderOffsets = make([]time.Duration, 0, len(config.ExamReminderOffsets))
+		for _, s := range config.ExamReminderOffsets {
+			offset, err := time.ParseDuration(s)
+			if err != nil || offset <= 0 {
+				log.Fatalf("invalid exam reminder offset %q in config", s)
+			}
+			examReminderOffsets = append(examReminderOffsets, offset)
+		}
+	}
+
+	noticePollingWorkers = defaultNoticePollingWorkers
+	if config.NoticePollingWorkers > 0 {
+		noticePollingWorkers = config.NoticePollingWorkers
+	}
+
+	inactiveUserGracePeriod = defaultInactiveUserGracePeriod
+	if config.InactiveUserGracePeriod != "" {
+		inactiveUserGracePeriod, err = time.ParseDuration(config.InactiveUserGracePeriod)
+		if err != nil || inactiveUserGracePeriod < 0 {
+			log.Fatalf("invalid inactive user grace period %q in config", config.InactiveUserGracePeriod)
+		}
+	}
+
+	leaderLeaseTTL = defaultLeaderLeaseTTL
+	if config.LeaderLeaseTTL != "" {
+		leaderLeaseTTL, err = time.ParseDuration(config.LeaderLeaseTTL)
+		if err != nil || leaderLeaseTTL/leaderLeaseRenewals < minLeaderLeaseRenewInterval {
+			log.Fatalf("invalid leader lease TTL %q in config, it must be at least %s to be renewed every %s",
+				config.LeaderLeaseTTL, leaderLeaseRenewals*minLeaderLeaseRenewInterval, minLeaderLeaseRenewInterval)
+		}
+	}
+	fibapi.OnBreakerStateChange(notifyFIBAPIOutage)
+
+	onLeaderTermBegin = func(ctx context.Context) {
+		CacheSubjectCodes(ctx)
+		if config.ScheduleClassRemindersCronExp != "" { // today's reminders are not scheduled if the daily run has been missed
+			ScheduleClassReminders(ctx)
+		}
+	}
+	instanceID = newInstanceID()
+	campaign()
+	stopLeaderElection = make(chan struct{})
+	leaderElectionFinished = make(chan struct{})
+	go runLeaderElection(stopLeaderElection, leaderElectionFinished)
+
 	scheduler = gocron.NewScheduler(tzMadrid)
 	scheduler.SetMaxConcurrentJobs(1, gocron.RescheduleMode)
 	addJobs(config)
 	scheduler.StartAsync()
+
+	stopReminderDispatcher = make(chan struct{})
+	go runReminderDispatcher(stopReminderDispatcher)
+	stopOutboxDispatcher = make(chan struct{})
+	go runOutboxDispatcher(stopOutboxDispatcher)
 }
 
 // Stop stops the jobs scheduler
 func Stop() {
+	cancelJobs() // abort the in-flight FIB API requests, instead of waiting for them
 	if scheduler != nil {
 		scheduler.Stop()
 	}
+	if stopLeaderElection != nil {
+		close(stopLeaderElection)
+		<-leaderElectionFinished // wait for the lease to be released before the DB is closed
+		stopLeaderElection = nil
+	}
+	if stopReminderDispatcher != nil {
+		close(stopReminderDispatcher)
+		stopReminderDispatcher = nil
+	}
+	if stopOutboxDispatcher != nil {
+		close(stopOutboxDispatcher)
+		stopOutboxDispatcher = nil
+	}
 	log.Debug("jobs scheduler stopped")
 }
 
+// notifyAdmins sends the given message to the admins, replaceable in tests
+var notifyAdmins = bot.NotifyAdmins
+
+// notifyFIBAPIOutage is called on each state change of the circuit breaker, see announceFIBAPIStatus
+func notifyFIBAPIOutage(_, to fibapi.BreakerStatus) {
+	announceFIBAPIStatus(to)
+}
+
+// announceFIBAPIStatus notifies the admins when FIB API goes down (i.e., the circuit breaker opens) and when it recovers,
+// only by the leader instance, which makes most of the requests
+// the state is compared with the last announced one stored in DB rather than with the breaker's previous state,
+// so the admins are notified once per outage, even if the leadership moves to an instance whose breaker is in another state
+func announceFIBAPIStatus(status fibapi.BreakerStatus) {
+	if currentTerm() == nil {
+		return
+	}
+	if status.State == fibapi.BreakerHalfOpen || (status.State == fibapi.BreakerClosed && status.Failures > 0) {
+		return // probing, or failing but not down yet
+	}
+
+	announced, ok, err := bot.GetAnnouncedFIBAPIStatus()
+	if err != nil {
+		log.Errorf("failed to get announced FIB API status: %v", err)
+		return
+	}
+	if !ok {
+		announced = fibapi.BreakerStatus{State: fibapi.BreakerClosed}
+	}
+	if status.State == announced.State {
+		return
+	}
+
+	if status.State == fibapi.BreakerOpen {
+		log.Warnf("FIB API is down after %d consecutive failures: %v", status.Failures, status.LastError)
+	} else {
+		if status.Since.Before(announced.Since) { // this instance's breaker has not opened during the outage
+			status.Since = time.Now()
+		}
+		log.Infof("FIB API has recovered after being down for %s", status.Since.Sub(announced.Since))
+	}
+	if err = bot.PutAnnouncedFIBAPIStatus(status); err != nil {
+		log.Errorf("failed to put announced FIB API status: %v", err)
+		return // announce it next time, rather than announcing it repeatedly
+	}
+	notifyAdmins(&bot.FIBAPIOutageMessage{From: announced, To: status})
+}
+
 // addJobs adds the jobs to the scheduler
 func addJobs(config Config) {
 	if config.PushNewNoticesCronExp != "" {
-		_, err := scheduler.Cron(config.PushNewNoticesCronExp).Tag("PushNewNotices").Do(PushNewNotices)
+		_, err := scheduler.Cron(config.PushNewNoticesCronExp).Tag("PushNewNotices").Do(leaderOnly("PushNewNotices", PushNewNotices))
 		if err != nil {
 			log.Errorf("failed to schedule PushNewNotices: %v", err)
 		}
 	}
 	if config.CacheSubjectCodesCronExp != "" {
-		_, err := scheduler.Cron(config.CacheSubjectCodesCronExp).Tag("CacheSubjectCodes").Do(CacheSubjectCodes)
+		_, err := scheduler.Cron(config.CacheSubjectCodesCronExp).Tag("CacheSubjectCodes").Do(leaderOnly("CacheSubjectCodes", CacheSubjectCodes))
 		if err != nil {
 			log.Errorf("failed to schedule CacheSubjectCodes: %v", err)
 		}
 	}
+	if config.PushDailyScheduleCronExp != "" {
+		_, err := scheduler.Cron(config.PushDailyScheduleCronExp).Tag("PushDailySchedule").Do(leaderOnly("PushDailySchedule", PushDailySchedule))
+		if err != nil {
+			log.Errorf("failed to schedule PushDailySchedule: %v", err)
+		}
+	}
+	if config.ScheduleClassRemindersCronExp != "" {
+		_, err := scheduler.Cron(config.ScheduleClassRemindersCronExp).Tag("ScheduleClassReminders").Do(leaderOnly("ScheduleClassReminders", ScheduleClassReminders))
+		if err != nil {
+			log.Errorf("failed to schedule ScheduleClassReminders: %v", err)
+		}
+	}
+	if config.ScheduleExamRemindersCronExp != "" {
+		_, err := scheduler.Cron(config.ScheduleExamRemindersCronExp).Tag("ScheduleExamReminders").Do(leaderOnly("ScheduleExamReminders", ScheduleExamReminders))
+		if err != nil {
+			log.Errorf("failed to schedule ScheduleExamReminders: %v", err)
+		}
+	}
+	if config.PruneSubjectSettingsCronExp != "" {
+		_, err := scheduler.Cron(config.PruneSubjectSettingsCronExp).Tag("PruneSubjectSettings").Do(leaderOnly("PruneSubjectSettings", PruneSubjectSettings))
+		if err != nil {
+			log.Errorf("failed to schedule PruneSubjectSettings: %v", err)
+		}
+	}
+	if config.RevokeInactiveUsersCronExp != "" {
+		_, err := scheduler.Cron(config.RevokeInactiveUsersCronExp).Tag("RevokeInactiveUsers").Do(leaderOnly("RevokeInactiveUsers", RevokeInactiveUsers))
+		if err != nil {
+			log.Errorf("failed to schedule RevokeInactiveUsers: %v", err)
+		}
+	}
 }
@@ -0,0 +1,49 @@
+package job
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"RacoBot/internal/bot"
+	"RacoBot/internal/db"
+	"RacoBot/pkg/fibapi"
+)
+
+func TestAnnounceFIBAPIStatus(t *testing.T) {
+	db.Init(db.StoreConfig{Backend: db.BackendMemory}, db.Config{})
+	defer db.Close()
+	var announced []fibapi.BreakerState
+	notifyAdmins = func(message interface{}) {
+		announced = append(announced, message.(*bot.FIBAPIOutageMessage).To.State)
+	}
+	defer func() { notifyAdmins = bot.NotifyAdmins }()
+
+	down := fibapi.BreakerStatus{State: fibapi.BreakerOpen, Since: time.Now(), Failures: 5, LastError: errors.New("timeout")}
+	up := fibapi.BreakerStatus{State: fibapi.BreakerClosed, Since: time.Now().Add(-time.Hour)}
+
+	announceFIBAPIStatus(down) // not the leader
+	if _, ok, _ := bot.GetAnnouncedFIBAPIStatus(); ok {
+		t.Error("got a stored status before any is announced")
+	}
+	instanceID, leaderLeaseTTL = "a", time.Minute
+	campaign()
+	defer func() { term = nil }()
+
+	announceFIBAPIStatus(up)   // never announced down
+	announceFIBAPIStatus(down) // down
+	announceFIBAPIStatus(down) // already announced, e.g., by the previous leader
+	announceFIBAPIStatus(fibapi.BreakerStatus{State: fibapi.BreakerClosed, Failures: 1})
+	announceFIBAPIStatus(up) // recovered, although this instance's breaker has not opened
+	announceFIBAPIStatus(up)
+
+	want := []fibapi.BreakerState{fibapi.BreakerOpen, fibapi.BreakerClosed}
+	if !slices.Equal(announced, want) {
+		t.Errorf("got announced states %v, want %v", announced, want)
+	}
+	// as read by `/status` on any instance
+	if status, ok, err := bot.GetAnnouncedFIBAPIStatus(); err != nil || !ok || status.State != fibapi.BreakerClosed {
+		t.Errorf("got stored status %+v, %t, %v, want it up", status, ok, err)
+	}
+}
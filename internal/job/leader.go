@@ -0,0 +1,130 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"RacoBot/internal/db"
+)
+
+// name of the lease held by the leader instance, which is the only one running the scheduled jobs
+const leaderLeaseName = "jobs"
+
+// defaultLeaderLeaseTTL is how long the leader lease lasts without being renewed, if not configured
+// it's renewed every `leaderLeaseRenewals`-th of it, so a crashed leader is taken over after at most this long
+const defaultLeaderLeaseTTL = 30 * time.Second
+
+const (
+	leaderLeaseRenewals         = 3           // times the leader lease is renewed within its TTL
+	minLeaderLeaseRenewInterval = time.Second // for a renewal to surely finish before the lease expires
+)
+
+// leaderTerm represents a term of this instance as the leader
+type leaderTerm struct {
+	token  int64              // the fencing token of the term
+	ctx    context.Context    // of the jobs run in the term, carrying its fence, cancelled when the term ends
+	cancel context.CancelFunc // ends the term
+}
+
+// onLeaderTermBegin is called (in a new goroutine) with the context of each term of this instance as the leader
+// when it begins, to catch up on the jobs the previous leader may have missed, e.g., if no instance was the leader when they were due
+var onLeaderTermBegin func(ctx context.Context)
+
+var (
+	instanceID             string // identifies this instance as a lease holder
+	leaderLeaseTTL         time.Duration
+	termMu                 sync.Mutex
+	term                   *leaderTerm // the current term, nil if this instance is not the leader
+	stopLeaderElection     chan struct{}
+	leaderElectionFinished chan struct{}
+)
+
+// newInstanceID generates an ID for this instance, with its hostname for easier debugging
+func newInstanceID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	hostname, _ := os.Hostname()
+	return hostname + "-" + hex.EncodeToString(buf)
+}
+
+// currentTerm returns the current term of this instance as the leader, nil if it's not the leader
+func currentTerm() *leaderTerm {
+	termMu.Lock()
+	defer termMu.Unlock()
+	return term
+}
+
+// campaign tries to acquire (or renew) the leader lease, and begins or ends this instance's term as the leader accordingly
+// ending a term cancels the jobs still running in it, and their writes are fenced off in case they're not aborted in time
+func campaign() {
+	token, err := db.AcquireLease(leaderLeaseName, instanceID, leaderLeaseTTL)
+	if err != nil {
+		log.Errorf("failed to acquire leader lease: %v", err)
+		token = 0 // the lease may expire before we can renew it
+	}
+
+	termMu.Lock()
+	defer termMu.Unlock()
+	if term != nil && term.token == token { // renewed
+		return
+	}
+	if term != nil {
+		term.cancel()
+		term = nil
+		log.Infof("instance %s is no longer the leader", instanceID)
+	}
+	if token != 0 {
+		termCtx, cancel := context.WithCancel(db.ContextWithFence(ctx, db.Fence{Lease: leaderLeaseName, Token: token}))
+		term = &leaderTerm{token: token, ctx: termCtx, cancel: cancel}
+		log.Infof("instance %s became the leader (term %d), running the scheduled jobs", instanceID, token)
+		if onLeaderTermBegin != nil {
+			go onLeaderTermBegin(termCtx)
+		}
+	}
+}
+
+// runLeaderElection campaigns for the leader lease periodically until the given channel is closed,
+// then ends the current term and releases the lease (if held) so another instance can take over right away
+func runLeaderElection(stop <-chan struct{}, finished chan<- struct{}) {
+	defer close(finished)
+	ticker := time.NewTicker(leaderLeaseTTL / leaderLeaseRenewals)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			termMu.Lock()
+			if term != nil {
+				term.cancel()
+				term = nil
+				if err := db.ReleaseLease(leaderLeaseName, instanceID); err != nil {
+					log.Errorf("failed to release leader lease: %v", err)
+				}
+			}
+			termMu.Unlock()
+			log.Debug("leader election stopped")
+			return
+		case <-ticker.C:
+			campaign()
+		}
+	}
+}
+
+// leaderOnly wraps the given job so that it only runs on the leader instance, with the context of the current term
+func leaderOnly(name string, job func(ctx context.Context)) func() {
+	return func() {
+		t := currentTerm()
+		if t == nil {
+			log.WithField("job", name).Debug("skipped on non-leader instance")
+			return
+		}
+		job(t.ctx)
+	}
+}
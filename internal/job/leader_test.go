@@ -0,0 +1,57 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"RacoBot/internal/db"
+)
+
+func TestCampaign(t *testing.T) {
+	db.Init(db.StoreConfig{Backend: db.BackendMemory}, db.Config{})
+	defer db.Close()
+	instanceID, leaderLeaseTTL = "a", 50*time.Millisecond
+	defer func() { term = nil }()
+
+	campaign()
+	first := currentTerm()
+	if first == nil {
+		t.Fatal("got no term, want this instance to be the leader")
+	}
+	var jobCtx context.Context
+	leaderOnly("test", func(ctx context.Context) { jobCtx = ctx })()
+	if jobCtx != first.ctx || db.FenceFromContext(jobCtx) != (db.Fence{Lease: leaderLeaseName, Token: first.token}) {
+		t.Errorf("got job context with fence %+v, want the one of term %d", db.FenceFromContext(jobCtx), first.token)
+	}
+
+	// renewed, in the same term
+	campaign()
+	if currentTerm() != first || first.ctx.Err() != nil {
+		t.Error("renewal: got a new term")
+	}
+
+	// taken over by another instance after the lease expires, e.g., this one was partitioned from the DB
+	time.Sleep(leaderLeaseTTL)
+	token, err := db.AcquireLease(leaderLeaseName, "b", time.Minute)
+	if err != nil || token <= first.token {
+		t.Fatalf("takeover: got token %d, %v", token, err)
+	}
+	campaign()
+	if currentTerm() != nil {
+		t.Error("got a term, want this instance to no longer be the leader")
+	}
+	if first.ctx.Err() == nil {
+		t.Error("the jobs of the ended term are not cancelled")
+	}
+	ran := false
+	leaderOnly("test", func(context.Context) { ran = true })()
+	if ran {
+		t.Error("job ran on a non-leader instance")
+	}
+
+	// and the writes of the jobs still running in the ended term are fenced off
+	if err = db.PutReminder(db.Reminder{ID: "r"}, time.Now(), db.FenceFromContext(first.ctx)); err != db.ErrFenced {
+		t.Errorf("putting reminder in the ended term: got %v, want fenced", err)
+	}
+}
@@ -0,0 +1,187 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"RacoBot/internal/bot"
+	"RacoBot/internal/db"
+)
+
+const (
+	outboxDispatchInterval  = 10 * time.Second
+	outboxDispatchBatchSize = 100
+	outboxClaimLease        = 5 * time.Minute // long enough for a batch to be sent
+	outboxMaxAttempts       = 8
+	outboxRetryBaseDelay    = 30 * time.Second
+	outboxRetryMaxDelay     = 2 * time.Hour
+)
+
+var stopOutboxDispatcher chan struct{}
+
+// sendOutboundNotice pushes an outbound notice to its user, replaced in tests
+var sendOutboundNotice = pushNotice
+
+// runOutboxDispatcher dispatches due outbound notices periodically until the given channel is closed
+// it runs apart from the jobs scheduler, so failed notices are retried on time no matter how long the other jobs take
+func runOutboxDispatcher(stop <-chan struct{}) {
+	ticker := time.NewTicker(outboxDispatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			log.Debug("outbox dispatcher stopped")
+			return
+		case <-ticker.C:
+			DispatchOutboundNotices()
+		}
+	}
+}
+
+// DispatchOutboundNotices delivers all queued notices which are due,
+// failed ones are retried with exponential backoff, or moved to the dead letters after too many attempts
+// or if they can't ever be delivered
+// a notice is marked as seen by the user only after it has been delivered (or given up on)
+func DispatchOutboundNotices() {
+	logger := log.WithField("job", "DispatchOutboundNotices")
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic recovered: %v", r)
+		}
+	}()
+
+	var dueCount, sentCount, retryCount, deadCount, heldCount int
+	for {
+		now := time.Now()
+		notices, err := db.ClaimDueOutboundNotices(now, outboxDispatchBatchSize, outboxClaimLease)
+		if err != nil {
+			logger.Errorf("failed to claim due outbound notices: %v", err)
+			return
+		}
+		dueCount += len(notices)
+
+		users := make(map[int64]*outboxUser)
+		unavailable := make(map[int64]bool) // users who failed to be got, whose notices are left claimed
+		for _, o := range notices {
+			userLogger := logger.WithField("UID", o.UserID)
+			if unavailable[o.UserID] {
+				heldCount++
+				continue
+			}
+			u, ok := users[o.UserID]
+			if !ok {
+				if u, err = newOutboxUser(o.UserID); err != nil {
+					// leave the notice claimed, so it's attempted again after the claim lease expires
+					userLogger.Errorf("failed to get user, retrying their outbound notices later: %v", err)
+					unavailable[o.UserID] = true
+					heldCount++
+					continue
+				}
+				users[o.UserID] = u
+			}
+			if u == nil { // the user has gone
+				if err = db.AckOutboundNotice(o.ID); err != nil {
+					userLogger.Errorf("failed to ack outbound notice %s: %v", o.ID, err)
+				}
+				continue
+			}
+
+			n, err := bot.NewOutboundNoticeMessage(o, u.User)
+			if err != nil {
+				userLogger.Errorf("failed to parse outbound notice %s: %v", o.ID, err)
+				o.Attempts = outboxMaxAttempts // can't ever be delivered
+			} else {
+				var sent bool
+				if sent, err = sendOutboundNotice(userLogger, n, u.rules, u.delivered); err == nil {
+					if sent {
+						sentCount++
+					}
+					if err = db.AckOutboundNotice(o.ID); err != nil {
+						userLogger.Errorf("failed to ack outbound notice %s: %v", o.ID, err)
+					}
+					continue
+				}
+				if bot.IsUserGoneError(err) { // the user has been marked as inactive, no point in retrying
+					userLogger.Infof("dropped outbound notice %s: %v", o.ID, err)
+					if err = db.AckOutboundNotice(o.ID); err != nil {
+						userLogger.Errorf("failed to ack outbound notice %s: %v", o.ID, err)
+					}
+					continue
+				}
+				o.Attempts++
+			}
+
+			o.LastError = err.Error()
+			o.FailedAt = now.Unix()
+			transient, retryAfter := bot.IsTransientError(err)
+			if transient && o.Attempts < outboxMaxAttempts {
+				delay := max(outboxRetryDelay(o.Attempts), retryAfter)
+				userLogger.Warnf("failed to send outbound notice %s (attempt %d), retrying in %s: %v", o.ID, o.Attempts, delay, err)
+				if err = db.RetryOutboundNotice(o, now.Add(delay)); err != nil {
+					userLogger.Errorf("failed to retry outbound notice %s: %v", o.ID, err)
+				}
+				retryCount++
+				continue
+			}
+
+			userLogger.Errorf("giving up outbound notice %s after %d attempts: %s", o.ID, o.Attempts, o.LastError)
+			if err = db.DeadLetterOutboundNotice(o); err != nil {
+				userLogger.Errorf("failed to dead-letter outbound notice %s: %v", o.ID, err)
+			}
+			deadCount++
+			if n.ID != 0 { // don't get it back on the next poll
+				markNoticeSeen(userLogger, n.Notice, o.UserID, u.delivered)
+			}
+		}
+
+		if len(notices) < outboxDispatchBatchSize {
+			break
+		}
+	}
+	if dueCount > 0 {
+		logger.Infof("sent %d/%d due outbound notices, %d to retry, %d dead-lettered, %d held", sentCount, dueCount, retryCount, deadCount, heldCount)
+	}
+}
+
+// outboxUser represents a user with outbound notices, along with what's needed to push notices to them
+type outboxUser struct {
+	db.User
+	rules     []db.AlertRule
+	delivered map[int32]db.DeliveredNotice
+}
+
+// newOutboxUser gets the user with the given ID along with their alert rules and delivered notices
+// it returns nil if the user doesn't exist anymore, or has blocked the bot or deleted their account
+func newOutboxUser(userID int64) (*outboxUser, error) {
+	user, err := db.GetUser(userID)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if user.InactiveSince != 0 {
+		return nil, nil
+	}
+	u := &outboxUser{User: user}
+	if u.rules, err = db.GetAlertRules(userID); err != nil {
+		return nil, fmt.Errorf("failed to get alert rules: %w", err)
+	}
+	// without them, notices delivered before would be sent again instead of being edited in place
+	if u.delivered, err = db.GetDeliveredNotices(userID); err != nil {
+		return nil, fmt.Errorf("failed to get delivered notices: %w", err)
+	}
+	return u, nil
+}
+
+// outboxRetryDelay returns the delay before the next attempt of an outbound notice which has failed the given times
+func outboxRetryDelay(attempts uint8) time.Duration {
+	delay := outboxRetryBaseDelay << (attempts - 1)
+	if delay <= 0 || delay > outboxRetryMaxDelay {
+		return outboxRetryMaxDelay
+	}
+	return delay
+}
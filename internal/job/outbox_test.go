@@ -0,0 +1,80 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/telebot.v3"
+
+	"RacoBot/internal/bot"
+	"RacoBot/internal/db"
+	"RacoBot/pkg/fibapi"
+)
+
+func TestDispatchOutboundNotices(t *testing.T) {
+	db.Init(db.StoreConfig{Backend: db.BackendMemory}, db.Config{})
+	defer db.Close()
+
+	// the results of sending the notices to each user
+	results := map[int64]error{
+		1: nil,
+		2: errors.New("connection reset by peer"), // transient
+		3: &tb.Error{Code: 400, Description: "Bad Request: chat not found"},
+	}
+	sent := make(map[int64]int)
+	sendOutboundNotice = func(_ *log.Entry, n bot.NoticeMessage, _ []db.AlertRule, _ map[int32]db.DeliveredNotice) (bool, error) {
+		sent[n.User.ID]++
+		err := results[n.User.ID]
+		return err == nil, err
+	}
+	defer func() { sendOutboundNotice = pushNotice }()
+
+	for userID := range results {
+		if err := db.PutUser(db.User{ID: userID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a user who can't be read (as if the DB failed), their tokens are encrypted with a key not configured
+	if err := db.PutUser(db.User{ID: 4, AccessToken: "enc:1:x"}); err != nil {
+		t.Fatal(err)
+	}
+	// 5 is a user who has gone
+	for userID := int64(1); userID <= 5; userID++ {
+		notice, _ := json.Marshal(fibapi.Notice{ID: 42, SubjectCode: "#INFO", Title: "Avís"})
+		if _, err := db.EnqueueOutboundNotice(db.NewOutboundNotice(userID, 42, 1, notice), db.Fence{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	DispatchOutboundNotices()
+
+	if sent[1] != 1 || sent[2] != 1 || sent[3] != 1 || sent[4] != 0 || sent[5] != 0 {
+		t.Errorf("got sent notices by user %v", sent)
+	}
+	deadLetters, total, err := db.GetDeadLetters(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || deadLetters[0].UserID != 3 {
+		t.Errorf("got dead letters %+v, want the one of user 3", deadLetters)
+	}
+	if delivered, _ := db.GetDeliveredNotices(3); len(delivered) != 1 {
+		t.Errorf("dead-lettered notice not marked as seen: %+v", delivered)
+	}
+
+	// only the retried notice (after its backoff) and the held one (after its claim lease) are attempted again
+	notices, err := db.ClaimDueOutboundNotices(time.Now().Add(outboxClaimLease+time.Second), 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[int64]uint8)
+	for _, o := range notices {
+		got[o.UserID] = o.Attempts
+	}
+	if len(got) != 2 || got[2] != 1 || got[4] != 0 {
+		t.Errorf("got outbound notices left by user (with attempts) %v, want those of users 2 (1) and 4 (0)", got)
+	}
+}
@@ -0,0 +1,52 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"RacoBot/internal/bot"
+	"RacoBot/internal/db"
+)
+
+// PruneSubjectSettings removes all users' per-subject settings of the subjects they are no longer enrolled in
+func PruneSubjectSettings(ctx context.Context) {
+	logger := log.WithField("job", "PruneSubjectSettings")
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic recovered: %v", r)
+		}
+	}()
+
+	var checkedUserCount int
+	start := time.Now()
+	users := db.NewUserIDIterator()
+	for users.Next() {
+		if ctx.Err() != nil { // the leadership has been lost, or the jobs are stopping
+			break
+		}
+		userID := users.UserID()
+		userLogger := logger.WithField("UID", userID)
+		client := bot.NewClientContext(ctx, userID)
+		if client == nil || client.User.InactiveSince != 0 ||
+			(len(client.User.SubjectNoticeModes) == 0 && len(client.User.MutedExamSubjects) == 0) {
+			continue
+		}
+
+		subjects, err := client.GetSubjects()
+		if err != nil {
+			userLogger.Errorf("failed to get subjects: %v", err)
+			continue
+		}
+		if err = client.PruneSubjectSettings(subjects); err != nil {
+			userLogger.Errorf("failed to prune subject settings: %v", err)
+			continue
+		}
+		checkedUserCount++
+	}
+	if err := users.Err(); err != nil {
+		logger.Errorf("failed to get user IDs: %v", err)
+	}
+	logger.Infof("checked subject settings of %d users in %s", checkedUserCount, time.Since(start))
+}
@@ -0,0 +1,73 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"RacoBot/internal/bot"
+	"RacoBot/internal/db"
+	"RacoBot/pkg/fibapi"
+)
+
+// PushDailySchedule pushes today's classes to all users who have opted in
+// weekends and days without any classes are skipped
+func PushDailySchedule(ctx context.Context) {
+	logger := log.WithField("job", "PushDailySchedule")
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic recovered: %v", r)
+		}
+	}()
+
+	today := time.Now().In(tzMadrid)
+	if today.Weekday() == time.Saturday || today.Weekday() == time.Sunday {
+		logger.Debug("skipped on weekend")
+		return
+	}
+
+	var optedInUserCount, sentCount uint32
+	start := time.Now()
+	users := db.NewUserIDIterator()
+	for users.Next() {
+		if ctx.Err() != nil { // the leadership has been lost, or the jobs are stopping
+			break
+		}
+		userID := users.UserID()
+		userLogger := logger.WithField("UID", userID)
+		client := bot.NewClientContext(ctx, userID)
+		if client == nil || !client.User.DailySchedule || client.User.InactiveSince != 0 {
+			continue
+		}
+		optedInUserCount++
+
+		classes, err := client.GetSchedule()
+		if err != nil {
+			userLogger.Errorf("failed to get schedule: %v", err)
+			continue
+		}
+
+		todayClasses := make([]fibapi.Class, 0, len(classes))
+		for _, c := range classes {
+			if c.Weekday() == today.Weekday() {
+				todayClasses = append(todayClasses, c)
+			}
+		}
+		if len(todayClasses) == 0 { // no classes today
+			continue
+		}
+
+		if bot.SendMessage(userID, &bot.ScheduleMessage{
+			Classes: todayClasses,
+			User:    client.User,
+			Date:    today,
+		}) != nil {
+			sentCount++
+		}
+	}
+	if err := users.Err(); err != nil {
+		logger.Errorf("failed to get user IDs: %v", err)
+	}
+	logger.Infof("sent today's classes to %d/%d opted-in users in %s", sentCount, optedInUserCount, time.Since(start))
+}
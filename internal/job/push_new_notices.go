@@ -1,7 +1,11 @@
 package job
 
 import (
+	"context"
+	"errors"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -14,8 +18,9 @@ import (
 )
 
 // PushNewNotices checks and pushes new notices for all users
-// NOTE: not using goroutine to do it concurrently because it's not worth it, FIB API server has poor concurrency, better reuse connection
-func PushNewNotices() {
+// users are checked concurrently by a bounded number of workers, FIB API server has poor concurrency,
+// so the requests to it are also rate limited (by fibapi) and reuse connections
+func PushNewNotices(ctx context.Context) {
 	logger := log.WithField("job", "PushNewNotices")
 	defer func() {
 		if r := recover(); r != nil {
@@ -23,82 +28,247 @@ func PushNewNotices() {
 		}
 	}()
 
-	userIDs, err := db.GetAllUserIDs()
-	if err != nil {
-		logger.Errorf("failed to get all user IDs: %v", err)
+	if status := fibapi.GetBreakerStatus(); status.State == fibapi.BreakerOpen { // short-circuit while FIB API is down
+		logger.Warnf("skipped as FIB API is down since %s: %v", status.Since.Format(time.RFC3339), status.LastError)
 		return
 	}
 
-	waitUntilSecond5() // FIXME: hacky
-
-	var checkedUserCount, totalFetchedCount, totalSentCount uint32
+	var userCount, checkedUserCount, totalFetchedCount, totalQueuedCount uint32
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var latencies []time.Duration
 	start := time.Now()
-	for _, userID := range userIDs {
-		userLogger := logger.WithField("UID", userID)
-		client := bot.NewClient(userID)
-		if client == nil {
-			// possible database corruption
-			userLogger.Error("failed to create client")
-			// try sending a message to the user to ask them to re-login to fix it
-			_ = bot.SendMessage(userID, &bot.ErrorMessage{
-				Text: locale.Get("default").FIBAPIAuthorizationExpiredMessage,
-			})
-			if err = db.DelUser(userID); err != nil {
-				logger.Errorf("failed to delete user %d: %v", userID, err)
+	startStats := fibapi.GetStats()
+	queue := make(chan int64)
+	for i := 0; i < noticePollingWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range queue {
+				if fibapi.GetBreakerStatus().State == fibapi.BreakerOpen { // FIB API went down meanwhile
+					continue
+				}
+				userStart := time.Now()
+				checked, fetched, queued := pollNewNotices(ctx, logger.WithField("UID", userID), userID)
+				latency := time.Since(userStart)
+
+				mu.Lock()
+				if checked {
+					checkedUserCount++
+					latencies = append(latencies, latency)
+				}
+				totalFetchedCount += fetched
+				totalQueuedCount += queued
+				mu.Unlock()
 			}
-			continue
+		}()
+	}
+	users := db.NewUserIDIterator()
+	for users.Next() {
+		if ctx.Err() != nil { // the leadership has been lost, or the jobs are stopping
+			break
+		}
+		queue <- users.UserID()
+		userCount++
+	}
+	close(queue)
+	wg.Wait()
+	if err := users.Err(); err != nil {
+		logger.Errorf("failed to get user IDs: %v", err)
+	}
+
+	slices.Sort(latencies)
+	stats := fibapi.GetStats().Sub(startStats) // may include the requests made meanwhile by others, e.g., bot handlers
+	logger.Infof("checked %d/%d users and queued %d/%d new notices in %s (latency p50 %s, p90 %s, p99 %s; "+
+		"FIB API retries %d, recovered %d, exhausted %d; not modified %d/%d, %d bytes saved)",
+		checkedUserCount, userCount,
+		totalQueuedCount, totalFetchedCount,
+		time.Since(start),
+		percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99),
+		stats.Retries, stats.Recovered, stats.Exhausted,
+		stats.NotModified, stats.Conditional, stats.BytesSaved)
+	status := fibapi.GetBreakerStatus()
+	if status.State != fibapi.BreakerClosed {
+		logger.Warnf("FIB API went down during the check: %v", status.LastError)
+	}
+	if checkedUserCount > 0 { // FIB API may have recovered since it was announced down, e.g., by the previous leader
+		announceFIBAPIStatus(status)
+	}
+
+	DispatchOutboundNotices() // deliver them right away
+}
+
+// pollNewNotices checks and queues new notices for the user with the given ID, with the given leader term context
+// it returns whether the user has been checked, and the numbers of fetched and queued new notices
+func pollNewNotices(ctx context.Context, logger *log.Entry, userID int64) (checked bool, fetched, queued uint32) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic recovered: %v", r)
+		}
+	}()
+
+	user, err := db.GetUser(userID)
+	if err != nil {
+		if !errors.Is(err, db.ErrUserNotFound) { // e.g., their tokens can't be decrypted with the configured keys
+			logger.Errorf("failed to get user %d: %v", userID, err)
 		}
+		return
+	}
+	client := bot.NewClientFromUser(ctx, user)
+	if client == nil {
+		// possible database corruption
+		logger.Error("failed to create client")
+		// try sending a message to the user to ask them to re-login to fix it
+		_ = bot.SendMessage(userID, &bot.ErrorMessage{
+			Text: locale.Get("default").FIBAPIAuthorizationExpiredMessage,
+		})
+		if err := db.DelUser(userID); err != nil {
+			logger.Errorf("failed to delete user %d: %v", userID, err)
+		}
+		return
+	}
+	if client.User.InactiveSince != 0 { // the user has blocked the bot or deleted their account
+		return
+	}
 
-		var newNotices []bot.NoticeMessage
-		newNotices, err = client.GetNewNotices()
-		if err != nil {
-			userLogger.Errorf("failed to get new notices: %v", err)
-			if err == fibapi.ErrAuthorizationExpired {
-				// notify the user that their FIB API authorization has expired
-				if bot.SendMessage(userID, &bot.ErrorMessage{
-					Text: locale.Get(client.User.LanguageCode).FIBAPIAuthorizationExpiredMessage,
-				}) != nil {
-					// delete them from DB if the notification was sent successfully
-					if err = db.DelUser(userID); err != nil {
-						logger.Errorf("failed to delete user %d: %v", userID, err)
-					}
+	newNotices, err := client.GetNewNotices()
+	if err != nil {
+		if errors.Is(err, fibapi.ErrCircuitOpen) { // FIB API is down, which is logged once by the job
+			return
+		}
+		logger.Errorf("failed to get new notices: %v", err)
+		if errors.Is(err, fibapi.ErrAuthorizationExpired) {
+			// notify the user that their FIB API authorization has expired
+			if bot.SendMessage(userID, &bot.ErrorMessage{
+				Text: locale.Get(client.User.LanguageCode).FIBAPIAuthorizationExpiredMessage,
+			}) != nil {
+				// delete them from DB if the notification was sent successfully
+				if err = db.DelUser(userID); err != nil {
+					logger.Errorf("failed to delete user %d: %v", userID, err)
 				}
 			}
-			continue
 		}
-		checkedUserCount++
+		return
+	}
+	checked = true
 
-		if len(newNotices) == 0 { // nothing new
+	fetched = uint32(len(newNotices))
+	failed := false
+	for _, n := range newNotices {
+		var ok bool
+		if ok, err = client.EnqueueNotice(n); err != nil {
+			logger.Errorf("failed to enqueue notice %d: %v", n.ID, err)
+			failed = true
 			continue
 		}
-		totalFetchedCount += uint32(len(newNotices))
-		var userSentCount uint32
-		for _, n := range newNotices {
-			var msg *tb.Message
-			// disable notification for banner notices (with subject code starts with `#`) if the user has opted to mute them
-			if strings.HasPrefix(n.SubjectCode, "#") && n.User.MuteBannerNotices {
-				msg = bot.SendMessage(userID, &n, tb.Silent)
-			} else {
-				msg = bot.SendMessage(userID, &n)
+		if ok {
+			queued++
+		}
+	}
+	if !failed { // otherwise fetch the notices again next time, to retry enqueueing the failed ones
+		if err = client.SaveNoticesValidators(); err != nil {
+			logger.Errorf("failed to save notices validators: %v", err)
+		}
+	}
+	if len(newNotices) > 0 {
+		logger.Infof("queued %d/%d new notices", queued, len(newNotices))
+	}
+	return
+}
+
+// percentile returns the p-th percentile (nearest-rank) of the given sorted durations, 0 if there are none
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+	return sorted[max(rank, 1)-1]
+}
+
+// pushNotice sends the given notice to its user, applying the user's notice mode of its subject and alert rules,
+// if the notice has been delivered before (i.e., it has been modified since), the delivered message is edited in place
+// and replied with a summary of what has changed instead
+// it returns whether the notice has been sent, and the error if it fails to be sent
+// the notice is marked as seen unless it fails, and the given delivered notices (must be non-nil) are updated accordingly
+func pushNotice(logger *log.Entry, n bot.NoticeMessage, rules []db.AlertRule, delivered map[int32]db.DeliveredNotice) (bool, error) {
+	userID := n.User.ID
+	actions := bot.MatchAlertRules(rules, n.Notice)
+	n.Prefix = actions.Prefix
+	mode := n.User.NoticeModeOf(n.SubjectCode)
+	if mode == db.NoticeModeDrop && !actions.Loud { // the user has opted to not receive notices of this subject
+		markNoticeSeen(logger, n.Notice, userID, delivered)
+		return false, nil
+	}
+	var opt []interface{}
+	// disable notification for banner notices (with subject code starts with `#`) if the user has opted to mute them,
+	// or for notices of subjects the user has opted to receive silently, unless a matching alert rule says otherwise
+	if ((strings.HasPrefix(n.SubjectCode, "#") && n.User.MuteBannerNotices) || mode == db.NoticeModeDeliverSilently) && !actions.Loud {
+		opt = append(opt, tb.Silent)
+	}
+
+	var msg *tb.Message
+	d, edit := delivered[n.ID]
+	edit = edit && d.MessageID != 0
+	if edit {
+		if err := bot.EditMessage(userID, d.MessageID, n.String()); err != nil {
+			if transient, _ := bot.IsTransientError(err); transient {
+				return false, err
 			}
-			if msg != nil {
-				userSentCount++
-				totalSentCount++
+			edit = false // the delivered message can't be edited (e.g., deleted by the user), send it as a new one
+		}
+	}
+	snapshot := n.Snapshot()
+	if edit {
+		msg = &tb.Message{ID: d.MessageID, Chat: &tb.Chat{ID: userID}}
+		replyOpt := append([]interface{}{&tb.SendOptions{ReplyTo: msg, AllowWithoutReply: true}}, opt...)
+		var changes *bot.NoticeChangesMessage
+		if d.Hash != "" && d.Hash != snapshot.Hash { // not delivered before content tracking, nor only its time has changed
+			old, err := db.GetNoticeSnapshot(n.ID, d.Hash)
+			if err == nil {
+				changes = &bot.NoticeChangesMessage{Old: old, New: snapshot, User: n.User}
+			} else if !errors.Is(err, db.ErrNoticeSnapshotNotFound) {
+				logger.Errorf("failed to get snapshot %s of notice %d: %v", d.Hash, n.ID, err)
 			}
 		}
-		userLogger.Infof("sent %d/%d new notices", userSentCount, len(newNotices))
+		if changes != nil {
+			bot.SendMessage(userID, changes, replyOpt...)
+		} else {
+			bot.SendMessage(userID, locale.Get(n.User.LanguageCode).NoticeUpdatedMessage, replyOpt...)
+		}
+	} else {
+		var err error
+		if msg, err = bot.TrySendMessage(userID, &n, opt...); err != nil {
+			return false, err
+		}
+	}
+	// the snapshot is shared by all the users the notice is delivered to, putting it again only refreshes its TTL
+	if err := db.PutNoticeSnapshot(n.ID, snapshot, n.ExpiresAt.Unix()); err != nil {
+		logger.Errorf("failed to put snapshot of notice %d: %v", n.ID, err)
+	}
+	d = db.DeliveredNotice{
+		MessageID: msg.ID,
+		Version:   n.PublishedAt.Unix(),
+		ExpiresAt: n.ExpiresAt.Unix(),
+		Hash:      snapshot.Hash,
+	}
+	if err := db.PutDeliveredNotice(userID, n.ID, d); err != nil {
+		logger.Errorf("failed to put delivered notice %d: %v", n.ID, err)
+	}
+	delivered[n.ID] = d
+	if actions.Pin {
+		bot.PinMessage(msg)
 	}
-	logger.Infof("checked %d/%d users and sent %d/%d new notices in %s",
-		checkedUserCount, len(userIDs),
-		totalSentCount, totalFetchedCount,
-		time.Since(start))
+	return true, nil
 }
 
-// waitUntilSecond5 waits until the current time is at least 5 seconds into the minute
-// its purpose is to avoid fetching notices too early (missing new notices) in case of the clock on FIB API server is slower
-func waitUntilSecond5() {
-	now := time.Now()
-	if now.Second() < 5 {
-		time.Sleep(time.Duration(5-now.Second()) * time.Second)
+// markNoticeSeen marks the given notice as seen by the user with the given ID without sending it,
+// its previously delivered message (if any) is kept, and the given delivered notices (must be non-nil) are updated accordingly
+func markNoticeSeen(logger *log.Entry, n fibapi.Notice, userID int64, delivered map[int32]db.DeliveredNotice) {
+	d := delivered[n.ID]
+	d.Version = n.PublishedAt.Unix()
+	d.ExpiresAt = n.ExpiresAt.Unix()
+	if err := db.PutDeliveredNotice(userID, n.ID, d); err != nil {
+		logger.Errorf("failed to put delivered notice %d: %v", n.ID, err)
 	}
+	delivered[n.ID] = d
 }
@@ -0,0 +1,203 @@
+package job
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"RacoBot/internal/bot"
+	"RacoBot/internal/db"
+	"RacoBot/pkg/fibapi"
+)
+
+const (
+	reminderDispatchInterval  = 30 * time.Second
+	reminderDispatchBatchSize = 100
+)
+
+var stopReminderDispatcher chan struct{}
+
+// ScheduleClassReminders schedules reminders for today's classes of all users who have enabled them
+// it can be run again any time, as the reminders are identified by their users, classes and times,
+// and those which have already been sent (or are too late) are skipped
+func ScheduleClassReminders(ctx context.Context) {
+	logger := log.WithField("job", "ScheduleClassReminders")
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic recovered: %v", r)
+		}
+	}()
+
+	today := time.Now().In(tzMadrid)
+	var userCount, reminderCount int
+	start := time.Now()
+	users := db.NewUserIDIterator()
+	for users.Next() {
+		if ctx.Err() != nil { // the leadership has been lost, or the jobs are stopping
+			break
+		}
+		userID := users.UserID()
+		client := bot.NewClientContext(ctx, userID)
+		if client == nil || client.User.ClassReminderMinutes == 0 || client.User.InactiveSince != 0 {
+			continue
+		}
+		userCount++
+
+		count, err := client.ScheduleClassReminders(today)
+		if err != nil {
+			logger.WithField("UID", userID).Errorf("failed to schedule class reminders: %v", err)
+		}
+		reminderCount += count
+	}
+	if err := users.Err(); err != nil {
+		logger.Errorf("failed to get user IDs: %v", err)
+	}
+	logger.Infof("scheduled %d class reminders for %d users in %s", reminderCount, userCount, time.Since(start))
+}
+
+// ScheduleExamReminders schedules reminders of all users' upcoming exams, and notifies them about the exams
+// whose time or classrooms have changed since the last run
+func ScheduleExamReminders(ctx context.Context) {
+	logger := log.WithField("job", "ScheduleExamReminders")
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic recovered: %v", r)
+		}
+	}()
+
+	start := time.Now()
+	exams, err := fibapi.GetPublicExamsContext(ctx)
+	if err != nil {
+		logger.Errorf("failed to get exams: %v", err)
+		return
+	}
+	logger.Infof("fetched %d exams in %v", len(exams), time.Since(start))
+
+	var userCount, syncedUserCount, changedCount int
+	start = time.Now()
+	users := db.NewUserIDIterator()
+	for users.Next() {
+		if ctx.Err() != nil { // the leadership has been lost, or the jobs are stopping
+			break
+		}
+		userID := users.UserID()
+		userCount++
+		userLogger := logger.WithField("UID", userID)
+		client := bot.NewClientContext(ctx, userID)
+		if client == nil || client.User.InactiveSince != 0 {
+			continue
+		}
+
+		subjects, err := client.GetSubjects()
+		if err != nil {
+			userLogger.Errorf("failed to get subjects: %v", err)
+			continue
+		}
+		upcoming := bot.FilterUpcomingExams(exams, subjects, time.Now())
+		changed, err := client.SyncExamReminders(upcoming, examReminderOffsets)
+		if err != nil {
+			userLogger.Errorf("failed to sync exam reminders: %v", err)
+		}
+		syncedUserCount++
+
+		for _, e := range changed {
+			if bot.SendMessage(userID, &bot.ExamUpdatedMessage{Exam: e, User: client.User}) != nil {
+				changedCount++
+			}
+		}
+	}
+	if err := users.Err(); err != nil {
+		logger.Errorf("failed to get user IDs: %v", err)
+	}
+	logger.Infof("synced exam reminders of %d/%d users and notified %d exam changes in %s",
+		syncedUserCount, userCount, changedCount, time.Since(start))
+}
+
+// runReminderDispatcher dispatches due reminders periodically until the given channel is closed
+// it runs apart from the jobs scheduler, so reminders are sent on time no matter how long the other jobs take
+func runReminderDispatcher(stop <-chan struct{}) {
+	ticker := time.NewTicker(reminderDispatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			log.Debug("reminder dispatcher stopped")
+			return
+		case <-ticker.C:
+			DispatchDueReminders()
+		}
+	}
+}
+
+// sendReminder sends a reminder message to its user, replaced in tests
+var sendReminder = bot.TrySendMessage
+
+// DispatchDueReminders sends all reminders that are due, those failing to be sent for a transient reason are retried
+// until they're too late
+func DispatchDueReminders() {
+	logger := log.WithField("job", "DispatchDueReminders")
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic recovered: %v", r)
+		}
+	}()
+
+	var dueCount, sentCount int
+	for {
+		now := time.Now()
+		reminders, err := db.PopDueReminders(now, reminderDispatchBatchSize)
+		if err != nil {
+			logger.Errorf("failed to pop due reminders: %v", err)
+			return
+		}
+		dueCount += len(reminders)
+
+		for _, r := range reminders {
+			if r.StartsAt < now.Unix() { // too late, e.g., the bot was down
+				continue
+			}
+			user, err := db.GetUser(r.UserID)
+			if err != nil {
+				if err != db.ErrUserNotFound { // it has been popped, so put it back to be retried
+					logger.Errorf("failed to get user %d: %v", r.UserID, err)
+					if err = db.PutReminder(r, now.Add(reminderDispatchInterval), db.Fence{}); err != nil {
+						logger.Errorf("failed to put back reminder %s: %v", r.ID, err)
+					}
+				}
+				continue
+			}
+			if user.InactiveSince != 0 { // the user has blocked the bot or deleted their account
+				continue
+			}
+			if r.Type == db.ClassReminder && user.ClassReminderMinutes == 0 { // disabled after being scheduled
+				continue
+			}
+			if r.Type == db.ExamReminder && slices.Contains(user.MutedExamSubjects, r.SubjectCode) { // muted after being scheduled
+				continue
+			}
+
+			if _, err = sendReminder(r.UserID, &bot.ReminderMessage{Reminder: r, User: user}); err != nil {
+				if transient, retryAfter := bot.IsTransientError(err); transient { // it has been popped, so put it back to be retried
+					delay := max(reminderDispatchInterval, retryAfter)
+					logger.Warnf("failed to send reminder %s, retrying in %s: %v", r.ID, delay, err)
+					if err = db.PutReminder(r, now.Add(delay), db.Fence{}); err != nil {
+						logger.Errorf("failed to put back reminder %s: %v", r.ID, err)
+					}
+				} else if !bot.IsUserGoneError(err) {
+					logger.Errorf("failed to send reminder %s: %v", r.ID, err)
+				}
+				continue
+			}
+			sentCount++
+		}
+
+		if len(reminders) < reminderDispatchBatchSize {
+			break
+		}
+	}
+	if dueCount > 0 {
+		logger.Infof("sent %d/%d due reminders", sentCount, dueCount)
+	}
+}
@@ -0,0 +1,92 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	tb "gopkg.in/telebot.v3"
+
+	"RacoBot/internal/bot"
+	"RacoBot/internal/db"
+)
+
+func TestDispatchDueRemindersRequeue(t *testing.T) {
+	db.Init(db.StoreConfig{Backend: db.BackendMemory}, db.Config{})
+	defer db.Close()
+
+	// a user who can't be read (as if the DB failed), their tokens are encrypted with a key not configured
+	if err := db.PutUser(db.User{ID: 1, AccessToken: "enc:1:x"}); err != nil {
+		t.Fatal(err)
+	}
+	// 2 is a user who has gone
+	startsAt := time.Now().Add(time.Hour).Unix()
+	for _, r := range []db.Reminder{{ID: "r1", UserID: 1, StartsAt: startsAt}, {ID: "r2", UserID: 2, StartsAt: startsAt}} {
+		if err := db.PutReminder(r, time.Now(), db.Fence{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	DispatchDueReminders()
+
+	reminders, err := db.PopDueReminders(time.Now().Add(reminderDispatchInterval+time.Second), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reminders) != 1 || reminders[0].ID != "r1" {
+		t.Errorf("got reminders left %+v, want only the one of the user who can't be read", reminders)
+	}
+}
+
+func TestDispatchDueRemindersRetry(t *testing.T) {
+	db.Init(db.StoreConfig{Backend: db.BackendMemory}, db.Config{})
+	defer db.Close()
+
+	// the results of sending the reminders to each user
+	results := map[int64]error{
+		1: nil,
+		2: errors.New("connection reset by peer"), // transient
+		3: tb.FloodError{RetryAfter: 120},
+		4: &tb.Error{Code: 400, Description: "Bad Request: chat not found"},
+	}
+	sendReminder = func(userID int64, _ interface{}, _ ...interface{}) (*tb.Message, error) {
+		return &tb.Message{}, results[userID]
+	}
+	defer func() { sendReminder = bot.TrySendMessage }()
+
+	startsAt := time.Now().Add(time.Hour).Unix()
+	for userID := range results {
+		if err := db.PutUser(db.User{ID: userID, ClassReminderMinutes: 10}); err != nil {
+			t.Fatal(err)
+		}
+		r := db.Reminder{ID: fmt.Sprintf("r%d", userID), UserID: userID, Type: db.ClassReminder, StartsAt: startsAt}
+		if err := db.PutReminder(r, time.Now(), db.Fence{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	DispatchDueReminders()
+
+	// the one failed transiently is retried after the dispatch interval, and the flood-controlled one after it's asked to
+	for _, tc := range []struct {
+		after time.Duration
+		want  []string
+	}{
+		{reminderDispatchInterval + time.Second, []string{"r2"}},
+		{2*time.Minute + time.Second, []string{"r3"}},
+	} {
+		reminders, err := db.PopDueReminders(time.Now().Add(tc.after), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range reminders {
+			got = append(got, r.ID)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("got reminders due in %s %v, want %v", tc.after, got, tc.want)
+		}
+	}
+}
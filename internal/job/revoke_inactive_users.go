@@ -0,0 +1,61 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"RacoBot/internal/bot"
+	"RacoBot/internal/db"
+)
+
+// RevokeInactiveUsers revokes the FIB API tokens of (and deletes) all users who have blocked the bot or deleted their account
+// for longer than the grace period
+func RevokeInactiveUsers(ctx context.Context) {
+	logger := log.WithField("job", "RevokeInactiveUsers")
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic recovered: %v", r)
+		}
+	}()
+
+	var inactiveUserCount, revokedCount int
+	start := time.Now()
+	deadline := start.Add(-inactiveUserGracePeriod).Unix()
+	users := db.NewUserIDIterator()
+	for users.Next() {
+		if ctx.Err() != nil { // the leadership has been lost, or the jobs are stopping
+			break
+		}
+		userID := users.UserID()
+		user, err := db.GetUser(userID)
+		if err != nil {
+			if err != db.ErrUserNotFound {
+				logger.Errorf("failed to get user %d: %v", userID, err)
+			}
+			continue
+		}
+		if user.InactiveSince == 0 {
+			continue
+		}
+		inactiveUserCount++
+		if user.InactiveSince > deadline { // still in the grace period
+			continue
+		}
+
+		// the user is deleted from DB even if the revocation fails
+		if client := bot.NewClientFromUser(ctx, user); client == nil { // without a token
+			if err = db.DelUser(userID); err != nil {
+				logger.Errorf("failed to delete user %d: %v", userID, err)
+			}
+		} else if err = client.Logout(); err != nil {
+			logger.WithField("UID", userID).Errorf("failed to revoke token: %v", err)
+		}
+		revokedCount++
+	}
+	if err := users.Err(); err != nil {
+		logger.Errorf("failed to get user IDs: %v", err)
+	}
+	logger.Infof("revoked %d/%d inactive users in %s", revokedCount, inactiveUserCount, time.Since(start))
+}
@@ -6,7 +6,7 @@ var ca = Locale{
 	StartMessage:                        "Si us plau, /login per autoritzar Racó Bot.",
 	LoginLinkMessage:                    `<a href="%s">Autoritzar Racó Bot amb UPC SSO.</a>`,
 	GreetingMessage:                     "Hola, %s!",
-	HelpMessage:                         "Pots fer servir:\n/test per obtenir una previsualització de l'últim avís.\n/logout per deixar de rebre els missatges i revocar l'autorització en el servidor.\n\nPer a informes de bugs (avisos amb text mal format, manca d'avisos, error en les traduccions, ...), sol·licituds de noves funcions o qualsevol altra consulta, utilitza <i><a href=\"https://github.com/zry98/RacoBot/issues\">GitHub Issues</a></i>, merci!",
+	HelpMessage:                         "Pots fer servir:\n/test per obtenir una previsualització de l'últim avís.\n/schedule per veure el teu horari de classes (de la setmana, d'avui o de demà).\n/exams per veure els teus propers exàmens.\n/logout per deixar de rebre els missatges i revocar l'autorització en el servidor.\n\nPer a informes de bugs (avisos amb text mal format, manca d'avisos, error en les traduccions, ...), sol·licituds de noves funcions o qualsevol altra consulta, utilitza <i><a href=\"https://github.com/zry98/RacoBot/issues\">GitHub Issues</a></i>, merci!",
 	AlreadyLoggedInMessage:              "Ja has iniciat la sessió, comprova /whoami; o /logout per revocar l'autorització.",
 	LogoutSucceededMessage:              "Has tancat la sessió amb èxit! I el token de FIB API ha estat revocat al servidor, pots fer servir /login per tornar a autoritzar.",
 	LogoutFailedMessage:                 `S'ha produït un error en tancar la sessió. Encara que el bot ja et va eliminar de la base de dades, pots revocar el token manualment a <a href="https://api.fib.upc.edu/v2/o/authorized_tokens/">el FIB API Dashboard</a> si ho desitges.`,
@@ -25,15 +25,63 @@ var ca = Locale{
 	PreferredLanguageSetMessage:         "El teu idioma preferit s'ha configurat a català.",
 	BannerNoticesMutedMessage:           "Has silenciat els avisos de banner (aquells que no són d'assignatures, per exemple, eleccions), pots reactivar les notificacions amb /toggle_mute_banner_notices.",
 	BannerNoticesUnmutedMessage:         "Has activat les notificacions dels avisos de banner (aquells que no són d'assignatures, per exemple, eleccions), pots silenciar-los amb /toggle_mute_banner_notices.",
+	WeekdayNames:                        [7]string{"Diumenge", "Dilluns", "Dimarts", "Dimecres", "Dijous", "Divendres", "Dissabte"},
+	NoClassesErrorMessage:               "<i>No hi ha classes.</i>",
+	ScheduleCommandUsageErrorMessage:    "<i>Ús: /schedule [today|tomorrow]</i>",
+	DailyScheduleEnabledMessage:         "Rebràs les teves classes del dia cada matí de dilluns a divendres, pots desactivar-ho amb /toggle_daily_schedule.",
+	DailyScheduleDisabledMessage:        "Ja no rebràs les teves classes del dia cada matí, pots tornar a activar-ho amb /toggle_daily_schedule.",
+	ClassReminderMessage:                "⏰ La classe de [#%s] (%s, grup %s) comença a les <b>%s</b>, aula: <b>%s</b>.",
+	ClassRemindersEnabledMessage:        "Se't recordarà %d minuts abans que comenci cada classe, pots desactivar-ho amb /class_reminders 0.",
+	ClassRemindersDisabledMessage:       "Els recordatoris de classes estan desactivats, pots activar-los amb /class_reminders &lt;minuts&gt;.",
+	ClassRemindersUsageErrorMessage:     "<i>Ús: /class_reminders &lt;minuts&gt; (0 per desactivar, fins a %d)</i>",
+	CalendarFeedMessage:                 "Subscriu-te a aquesta URL a la teva aplicació de calendari (Google Calendar, Apple Calendar, ...) per tenir-hi les teves classes:\n<code>%s</code>\n\nMantén-la en privat, qualsevol que la tingui pot veure el teu horari; pots obtenir-ne una de nova (i revocar aquesta) amb /calendar rotate.",
+	CalendarCommandUsageErrorMessage:    "<i>Ús: /calendar [rotate]</i>",
+	ExamsMessageHeader:                  "<b>📝 Propers exàmens</b>",
+	ExamTypeNames:                       map[string]string{"P": "Parcial", "F": "Final"},
+	ExamLabText:                         "laboratori",
+	NoUpcomingExamsErrorMessage:         "<i>No hi ha propers exàmens.</i>",
+	ExamReminderMessage:                 "⏰ Examen de [#%s] (%s) el <b>%s</b>, aules: <b>%s</b>.",
+	ExamUpdatedMessageHeader:            "<b>📝 Examen actualitzat</b>",
+	ExamRemindersUsageMessage:           "Fes servir /toggle_exam_reminders &lt;assignatura&gt; per deixar de rebre o tornar a rebre recordatoris dels exàmens d'una assignatura.\nAssignatures silenciades: %s",
+	ExamRemindersMutedMessage:           "Ja no rebràs recordatoris dels exàmens de %s, pots desfer-ho amb la mateixa comanda.",
+	ExamRemindersUnmutedMessage:         "Tornaràs a rebre recordatoris dels exàmens de %s.",
+	NoticeSettingsMenuText:              "Toca una assignatura per canviar com es lliuren els seus avisos:\n🔔 amb notificació\n🔕 en silenci\n🚫 no es lliuren",
+	NoSubjectsErrorMessage:              "<i>No estàs matriculat a cap assignatura.</i>",
+	AddAlertRuleUsageErrorMessage:       "<i>Ús: /add_rule /regex/[i] [loud] [pin] [prefix &lt;text&gt;]\nLa regla s'aplica als avisos el títol o el text dels quals coincideixin amb l'expressió regular (sense distingir majúscules amb <code>i</code>): <code>loud</code> sempre notifica, <code>pin</code> fixa el missatge, <code>prefix</code> hi anteposa el text.\nP. ex.: <code>/add_rule /examen|exam/i loud pin</code></i>",
+	AlertRuleInvalidPatternErrorMessage: "<i>Expressió regular no vàlida: %s</i>",
+	AlertRulePatternTooLongErrorMessage: "<i>L'expressió regular no pot tenir més de %d caràcters.</i>",
+	AlertRulePrefixTooLongErrorMessage:  "<i>El prefix no pot tenir més de %d caràcters.</i>",
+	AlertRulesLimitErrorMessage:         "<i>Pots tenir fins a %d regles, primer elimina'n alguna amb /del_rule.</i>",
+	AlertRuleAddedMessage:               "S'ha afegit la regla, comprova totes les teves regles amb /rules.",
+	AlertRulesListHeader:                "<b>Les teves regles d'alerta:</b>",
+	NoAlertRulesErrorMessage:            "<i>No tens cap regla d'alerta, afegeix-ne una amb /add_rule.</i>",
+	DelAlertRuleUsageErrorMessage:       "<i>Ús: /del_rule &lt;número&gt; (segons /rules)</i>",
+	AlertRuleDeletedMessage:             "S'ha eliminat la regla.",
+	NoticeUpdatedMessage:                "✏️ <i>Aquest avís s'ha actualitzat.</i>",
+	NoticeTitleChangedLabel:             "<i>Títol:</i>",
+	NoticeAttachmentsAddedLabel:         "<i>Adjunts afegits:</i>",
+	NoticeAttachmentsRemovedLabel:       "<i>Adjunts eliminats:</i>",
+	NoticeTextChangedLabel:              "<i>Text:</i>",
+	FIBAPIStatusUpMessage:               "✅ L'API de la FIB funciona amb normalitat.",
+	FIBAPIStatusDownMessage:             "⚠️ L'API de la FIB no està disponible des de %s, els nous avisos es lliuraran quan es recuperi.",
 	//Authorized:                          "Autoritzat",
 	//AuthorizedResponseMessage:           "Ja pots tancar aquesta pestanya del navegador i tornar a Telegram.",
 	CommandsMenu: []tb.Command{
 		{Text: "help", Description: "Mostra el missatge d'ajuda"},
 		{Text: "login", Description: "Autoritzar bot a l'API de la FIB"},
 		{Text: "lang", Description: "Seleccionar l'idioma preferit"},
+		{Text: "notice_settings", Description: "Configurar avisos per assignatura"},
+		{Text: "rules", Description: "Mostrar regles d'alerta d'avisos"},
 		{Text: "toggle_mute_banner_notices", Description: "Alternar el silenci d'avisos de banner"},
+		{Text: "toggle_daily_schedule", Description: "Alternar l'enviament diari de classes"},
+		{Text: "class_reminders", Description: "Configurar recordatoris de classes"},
+		{Text: "toggle_exam_reminders", Description: "Alternar recordatoris d'exàmens"},
+		{Text: "calendar", Description: "Obtenir el calendari de classes"},
 		{Text: "whoami", Description: "Mostrar informació personal"},
 		{Text: "test", Description: "Mostrar el darrer avís"},
+		{Text: "schedule", Description: "Mostrar l'horari de classes"},
+		{Text: "exams", Description: "Mostrar els propers exàmens"},
+		{Text: "status", Description: "Mostrar l'estat de l'API de la FIB"},
 		{Text: "logout", Description: "Desautoritzar bot"},
 	},
 }
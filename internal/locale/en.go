@@ -6,7 +6,7 @@ var en = Locale{
 	StartMessage:                        "Please /login to authorize Racó Bot.",
 	LoginLinkMessage:                    `<a href="%s">Authorize Racó Bot with UPC SSO.</a>`,
 	GreetingMessage:                     "Hello, %s!",
-	HelpMessage:                         "You can use:\n/test to preview the latest one notice.\n/logout to stop receiving messages and revoke the authorization on server.\n\nFor bug reports (notices with malformed text, missing notices, error in translations, ...), feature requests, or any other inquiries, please use <i><a href=\"https://github.com/zry98/RacoBot/issues\">GitHub Issues</a></i>, thanks!",
+	HelpMessage:                         "You can use:\n/test to preview the latest one notice.\n/schedule to view your class schedule (of the week, today or tomorrow).\n/exams to view your upcoming exams.\n/logout to stop receiving messages and revoke the authorization on server.\n\nFor bug reports (notices with malformed text, missing notices, error in translations, ...), feature requests, or any other inquiries, please use <i><a href=\"https://github.com/zry98/RacoBot/issues\">GitHub Issues</a></i>, thanks!",
 	AlreadyLoggedInMessage:              "You are already logged-in, check /whoami; or /logout to revoke the authorization.",
 	LogoutSucceededMessage:              "You have successfully logged-out! And your FIB API token has been revoked on server, you can use /login to re-authorize.",
 	LogoutFailedMessage:                 `An error has occurred while logging you out. Although the bot has already deleted you from the database, you can revoke the token manually on <a href="https://api.fib.upc.edu/v2/o/authorized_tokens/">the FIB API Dashboard</a> if you want.`,
@@ -25,15 +25,63 @@ var en = Locale{
 	PreferredLanguageSetMessage:         "Your preferred language has been set to English.",
 	BannerNoticesMutedMessage:           "You have muted the banner notices (those not of subjects, e.g., elections), you can unmute them by /toggle_mute_banner_notices.",
 	BannerNoticesUnmutedMessage:         "You have unmuted the banner notices (those not of subjects, e.g., elections), you can mute them by /toggle_mute_banner_notices.",
+	WeekdayNames:                        [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	NoClassesErrorMessage:               "<i>No classes.</i>",
+	ScheduleCommandUsageErrorMessage:    "<i>Usage: /schedule [today|tomorrow]</i>",
+	DailyScheduleEnabledMessage:         "You will receive your classes of the day every weekday morning, you can disable it by /toggle_daily_schedule.",
+	DailyScheduleDisabledMessage:        "You will no longer receive your classes of the day every morning, you can enable it again by /toggle_daily_schedule.",
+	ClassReminderMessage:                "⏰ The class of [#%s] (%s, group %s) starts at <b>%s</b>, classroom: <b>%s</b>.",
+	ClassRemindersEnabledMessage:        "You will be reminded %d minutes before each class starts, you can disable it by /class_reminders 0.",
+	ClassRemindersDisabledMessage:       "Class reminders are disabled, you can enable them by /class_reminders &lt;minutes&gt;.",
+	ClassRemindersUsageErrorMessage:     "<i>Usage: /class_reminders &lt;minutes&gt; (0 to disable, up to %d)</i>",
+	CalendarFeedMessage:                 "Subscribe to this URL in your calendar app (Google Calendar, Apple Calendar, ...) to get your classes in it:\n<code>%s</code>\n\nKeep it private, anyone with it can see your schedule; you can get a new one (and revoke this one) by /calendar rotate.",
+	CalendarCommandUsageErrorMessage:    "<i>Usage: /calendar [rotate]</i>",
+	ExamsMessageHeader:                  "<b>📝 Upcoming exams</b>",
+	ExamTypeNames:                       map[string]string{"P": "Midterm", "F": "Final"},
+	ExamLabText:                         "lab",
+	NoUpcomingExamsErrorMessage:         "<i>No upcoming exams.</i>",
+	ExamReminderMessage:                 "⏰ Exam of [#%s] (%s) on <b>%s</b>, classrooms: <b>%s</b>.",
+	ExamUpdatedMessageHeader:            "<b>📝 Exam updated</b>",
+	ExamRemindersUsageMessage:           "Use /toggle_exam_reminders &lt;subject&gt; to stop or resume getting reminded of the exams of a subject.\nMuted subjects: %s",
+	ExamRemindersMutedMessage:           "You will no longer be reminded of the exams of %s, you can undo it by the same command.",
+	ExamRemindersUnmutedMessage:         "You will be reminded of the exams of %s again.",
+	NoticeSettingsMenuText:              "Tap a subject to switch how its notices are delivered:\n🔔 with notification\n🔕 silently\n🚫 not delivered",
+	NoSubjectsErrorMessage:              "<i>You are not enrolled in any subjects.</i>",
+	AddAlertRuleUsageErrorMessage:       "<i>Usage: /add_rule /regex/[i] [loud] [pin] [prefix &lt;text&gt;]\nThe rule applies to the notices whose title or text match the regular expression (case-insensitive with <code>i</code>): <code>loud</code> always notifies, <code>pin</code> pins the message, <code>prefix</code> prepends the text to it.\nE.g.: <code>/add_rule /examen|exam/i loud pin</code></i>",
+	AlertRuleInvalidPatternErrorMessage: "<i>Invalid regular expression: %s</i>",
+	AlertRulePatternTooLongErrorMessage: "<i>The regular expression can't be longer than %d characters.</i>",
+	AlertRulePrefixTooLongErrorMessage:  "<i>The prefix can't be longer than %d characters.</i>",
+	AlertRulesLimitErrorMessage:         "<i>You can have up to %d rules, delete some of them by /del_rule first.</i>",
+	AlertRuleAddedMessage:               "The rule has been added, check all your rules by /rules.",
+	AlertRulesListHeader:                "<b>Your alert rules:</b>",
+	NoAlertRulesErrorMessage:            "<i>You don't have any alert rules, add one by /add_rule.</i>",
+	DelAlertRuleUsageErrorMessage:       "<i>Usage: /del_rule &lt;number&gt; (as listed by /rules)</i>",
+	AlertRuleDeletedMessage:             "The rule has been deleted.",
+	NoticeUpdatedMessage:                "✏️ <i>This notice has been updated.</i>",
+	NoticeTitleChangedLabel:             "<i>Title:</i>",
+	NoticeAttachmentsAddedLabel:         "<i>Attachments added:</i>",
+	NoticeAttachmentsRemovedLabel:       "<i>Attachments removed:</i>",
+	NoticeTextChangedLabel:              "<i>Text:</i>",
+	FIBAPIStatusUpMessage:               "✅ FIB API is working normally.",
+	FIBAPIStatusDownMessage:             "⚠️ FIB API is unavailable since %s, new notices will be delivered once it recovers.",
 	//Authorized:                          "Authorized",
 	//AuthorizedResponseMessage:           "You can now close this browser tab and return to Telegram.",
 	CommandsMenu: []tb.Command{
 		{Text: "help", Description: "Show help message"},
 		{Text: "login", Description: "Authorize bot on FIB API"},
 		{Text: "lang", Description: "Select preferred language"},
+		{Text: "notice_settings", Description: "Set notice delivery per subject"},
+		{Text: "rules", Description: "Show alert rules on notices"},
 		{Text: "toggle_mute_banner_notices", Description: "Toggle mute banner notices"},
+		{Text: "toggle_daily_schedule", Description: "Toggle daily classes push"},
+		{Text: "class_reminders", Description: "Set reminders before classes"},
+		{Text: "toggle_exam_reminders", Description: "Toggle exam reminders of a subject"},
+		{Text: "calendar", Description: "Get the calendar feed of classes"},
 		{Text: "whoami", Description: "Show personal information"},
 		{Text: "test", Description: "Show the latest one notice"},
+		{Text: "schedule", Description: "Show class schedule"},
+		{Text: "exams", Description: "Show upcoming exams"},
+		{Text: "status", Description: "Show FIB API status"},
 		{Text: "logout", Description: "De-authorize bot"},
 	},
 }
@@ -6,7 +6,7 @@ var es = Locale{
 	StartMessage:                        "Por favor, /login para autorizar Racó Bot.",
 	LoginLinkMessage:                    `<a href="%s">Autorizar Racó Bot con UPC SSO.</a>`,
 	GreetingMessage:                     "¡Hola, %s!",
-	HelpMessage:                         "Puedes usar:\n/test para obtener una vista previa del último aviso.\n/logout para dejar de recibir mensajes y revocar la autorización en el servidor.\n\nPara informes de bugs (avisos con texto mal formado, falta de avisos, error en las traducciones, ...), solicitudes de funciones o cualquier otra consulta, utiliza <i><a href=\"https://github.com/zry98/RacoBot/issues\">GitHub Issues</a></i>, ¡gracias!",
+	HelpMessage:                         "Puedes usar:\n/test para obtener una vista previa del último aviso.\n/schedule para ver tu horario de clases (de la semana, de hoy o de mañana).\n/exams para ver tus próximos exámenes.\n/logout para dejar de recibir mensajes y revocar la autorización en el servidor.\n\nPara informes de bugs (avisos con texto mal formado, falta de avisos, error en las traducciones, ...), solicitudes de funciones o cualquier otra consulta, utiliza <i><a href=\"https://github.com/zry98/RacoBot/issues\">GitHub Issues</a></i>, ¡gracias!",
 	AlreadyLoggedInMessage:              "Ya has iniciado la sesión, comprueba /whoami; o /logout para revocar la autorización.",
 	LogoutSucceededMessage:              "¡Has cerrado la sesión con éxito! Y tu token de FIB API ha sido revocado en el servidor, puedes usar /login para volver a autorizar.",
 	LogoutFailedMessage:                 `Se ha producido un error al cerrar la sesión. Aunque el bot ya te ha eliminado de la base de datos, puedes revocar el token manualmente en <a href="https://api.fib.upc.edu/v2/o/authorized_tokens/">el FIB API Dashboard</a> si lo deseas.`,
@@ -25,15 +25,63 @@ var es = Locale{
 	PreferredLanguageSetMessage:         "Tu idioma preferido se ha configurado a castellano.",
 	BannerNoticesMutedMessage:           "Has silenciado los avisos de banner (aquellos que no son de asignaturas, por ejemplo, elecciones), puedes reactivar las notificaciones con /toggle_mute_banner_notices.",
 	BannerNoticesUnmutedMessage:         "Has activado las notificaciones de los avisos de banner (aquellos que no son de asignaturas, por ejemplo, elecciones), puedes silenciarlos con /toggle_mute_banner_notices.",
+	WeekdayNames:                        [7]string{"Domingo", "Lunes", "Martes", "Miércoles", "Jueves", "Viernes", "Sábado"},
+	NoClassesErrorMessage:               "<i>No hay clases.</i>",
+	ScheduleCommandUsageErrorMessage:    "<i>Uso: /schedule [today|tomorrow]</i>",
+	DailyScheduleEnabledMessage:         "Recibirás tus clases del día cada mañana de lunes a viernes, puedes desactivarlo con /toggle_daily_schedule.",
+	DailyScheduleDisabledMessage:        "Ya no recibirás tus clases del día cada mañana, puedes volver a activarlo con /toggle_daily_schedule.",
+	ClassReminderMessage:                "⏰ La clase de [#%s] (%s, grupo %s) empieza a las <b>%s</b>, aula: <b>%s</b>.",
+	ClassRemindersEnabledMessage:        "Se te recordará %d minutos antes de que empiece cada clase, puedes desactivarlo con /class_reminders 0.",
+	ClassRemindersDisabledMessage:       "Los recordatorios de clases están desactivados, puedes activarlos con /class_reminders &lt;minutos&gt;.",
+	ClassRemindersUsageErrorMessage:     "<i>Uso: /class_reminders &lt;minutos&gt; (0 para desactivar, hasta %d)</i>",
+	CalendarFeedMessage:                 "Suscríbete a esta URL en tu aplicación de calendario (Google Calendar, Apple Calendar, ...) para tener tus clases en ella:\n<code>%s</code>\n\nMantenla en privado, cualquiera que la tenga puede ver tu horario; puedes obtener una nueva (y revocar esta) con /calendar rotate.",
+	CalendarCommandUsageErrorMessage:    "<i>Uso: /calendar [rotate]</i>",
+	ExamsMessageHeader:                  "<b>📝 Próximos exámenes</b>",
+	ExamTypeNames:                       map[string]string{"P": "Parcial", "F": "Final"},
+	ExamLabText:                         "laboratorio",
+	NoUpcomingExamsErrorMessage:         "<i>No hay próximos exámenes.</i>",
+	ExamReminderMessage:                 "⏰ Examen de [#%s] (%s) el <b>%s</b>, aulas: <b>%s</b>.",
+	ExamUpdatedMessageHeader:            "<b>📝 Examen actualizado</b>",
+	ExamRemindersUsageMessage:           "Usa /toggle_exam_reminders &lt;asignatura&gt; para dejar de recibir o volver a recibir recordatorios de los exámenes de una asignatura.\nAsignaturas silenciadas: %s",
+	ExamRemindersMutedMessage:           "Ya no recibirás recordatorios de los exámenes de %s, puedes deshacerlo con el mismo comando.",
+	ExamRemindersUnmutedMessage:         "Volverás a recibir recordatorios de los exámenes de %s.",
+	NoticeSettingsMenuText:              "Toca una asignatura para cambiar cómo se entregan sus avisos:\n🔔 con notificación\n🔕 en silencio\n🚫 no se entregan",
+	NoSubjectsErrorMessage:              "<i>No estás matriculado en ninguna asignatura.</i>",
+	AddAlertRuleUsageErrorMessage:       "<i>Uso: /add_rule /regex/[i] [loud] [pin] [prefix &lt;texto&gt;]\nLa regla se aplica a los avisos cuyo título o texto coincidan con la expresión regular (sin distinguir mayúsculas con <code>i</code>): <code>loud</code> siempre notifica, <code>pin</code> fija el mensaje, <code>prefix</code> le antepone el texto.\nP. ej.: <code>/add_rule /examen|exam/i loud pin</code></i>",
+	AlertRuleInvalidPatternErrorMessage: "<i>Expresión regular no válida: %s</i>",
+	AlertRulePatternTooLongErrorMessage: "<i>La expresión regular no puede tener más de %d caracteres.</i>",
+	AlertRulePrefixTooLongErrorMessage:  "<i>El prefijo no puede tener más de %d caracteres.</i>",
+	AlertRulesLimitErrorMessage:         "<i>Puedes tener hasta %d reglas, primero elimina alguna con /del_rule.</i>",
+	AlertRuleAddedMessage:               "Se ha añadido la regla, comprueba todas tus reglas con /rules.",
+	AlertRulesListHeader:                "<b>Tus reglas de alerta:</b>",
+	NoAlertRulesErrorMessage:            "<i>No tienes ninguna regla de alerta, añade una con /add_rule.</i>",
+	DelAlertRuleUsageErrorMessage:       "<i>Uso: /del_rule &lt;número&gt; (según /rules)</i>",
+	AlertRuleDeletedMessage:             "Se ha eliminado la regla.",
+	NoticeUpdatedMessage:                "✏️ <i>Este aviso se ha actualizado.</i>",
+	NoticeTitleChangedLabel:             "<i>Título:</i>",
+	NoticeAttachmentsAddedLabel:         "<i>Adjuntos añadidos:</i>",
+	NoticeAttachmentsRemovedLabel:       "<i>Adjuntos eliminados:</i>",
+	NoticeTextChangedLabel:              "<i>Texto:</i>",
+	FIBAPIStatusUpMessage:               "✅ La API de la FIB funciona con normalidad.",
+	FIBAPIStatusDownMessage:             "⚠️ La API de la FIB no está disponible desde %s, los nuevos avisos se entregarán cuando se recupere.",
 	//Authorized:                          "Autorizado",
 	//AuthorizedResponseMessage:           "Ya puedes cerrar esta pestaña del navegador y volver a Telegram.",
 	CommandsMenu: []tb.Command{
 		{Text: "help", Description: "Mostrar el mensaje de ayuda"},
 		{Text: "login", Description: "Autorizar bot en la FIB API"},
 		{Text: "lang", Description: "Seleccionar el idioma preferido"},
+		{Text: "notice_settings", Description: "Configurar avisos por asignatura"},
+		{Text: "rules", Description: "Mostrar reglas de alerta de avisos"},
 		{Text: "toggle_mute_banner_notices", Description: "Alternar silencio de avisos de banner"},
+		{Text: "toggle_daily_schedule", Description: "Alternar envío diario de clases"},
+		{Text: "class_reminders", Description: "Configurar recordatorios de clases"},
+		{Text: "toggle_exam_reminders", Description: "Alternar recordatorios de exámenes"},
+		{Text: "calendar", Description: "Obtener el calendario de clases"},
 		{Text: "whoami", Description: "Mostrar información personal"},
 		{Text: "test", Description: "Mostrar el último aviso"},
+		{Text: "schedule", Description: "Mostrar el horario de clases"},
+		{Text: "exams", Description: "Mostrar los próximos exámenes"},
+		{Text: "status", Description: "Mostrar el estado de la API de la FIB"},
 		{Text: "logout", Description: "Desautorizar bot"},
 	},
 }
@@ -26,6 +26,45 @@ type Locale struct {
 	PreferredLanguageSetMessage         string
 	BannerNoticesMutedMessage           string
 	BannerNoticesUnmutedMessage         string
+	WeekdayNames                        [7]string
+	NoClassesErrorMessage               string
+	ScheduleCommandUsageErrorMessage    string
+	DailyScheduleEnabledMessage         string
+	DailyScheduleDisabledMessage        string
+	ClassReminderMessage                string
+	ClassRemindersEnabledMessage        string
+	ClassRemindersDisabledMessage       string
+	ClassRemindersUsageErrorMessage     string
+	CalendarFeedMessage                 string
+	CalendarCommandUsageErrorMessage    string
+	ExamsMessageHeader                  string
+	ExamTypeNames                       map[string]string
+	ExamLabText                         string
+	NoUpcomingExamsErrorMessage         string
+	ExamReminderMessage                 string
+	ExamUpdatedMessageHeader            string
+	ExamRemindersUsageMessage           string
+	ExamRemindersMutedMessage           string
+	ExamRemindersUnmutedMessage         string
+	NoticeSettingsMenuText              string
+	NoSubjectsErrorMessage              string
+	AddAlertRuleUsageErrorMessage       string
+	AlertRuleInvalidPatternErrorMessage string
+	AlertRulePatternTooLongErrorMessage string
+	AlertRulePrefixTooLongErrorMessage  string
+	AlertRulesLimitErrorMessage         string
+	AlertRuleAddedMessage               string
+	AlertRulesListHeader                string
+	NoAlertRulesErrorMessage            string
+	DelAlertRuleUsageErrorMessage       string
+	AlertRuleDeletedMessage             string
+	NoticeUpdatedMessage                string
+	NoticeTitleChangedLabel             string
+	NoticeAttachmentsAddedLabel         string
+	NoticeAttachmentsRemovedLabel       string
+	NoticeTextChangedLabel              string
+	FIBAPIStatusUpMessage               string
+	FIBAPIStatusDownMessage             string
 	//Authorized                          string
 	//AuthorizedResponseMessage           string
 	CommandsMenu []tb.Command
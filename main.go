@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -21,12 +22,21 @@ import (
 )
 
 var (
-	config Config
-	srv    *http.Server
+	config               Config
+	srv                  *http.Server
+	srvCtx, cancelSrvCtx = context.WithCancel(context.Background()) // base context of HTTP requests, cancelled on shutdown
+	migrateDryRun        bool
+	archiveKeyFile       string
 )
 
 func init() {
 	configPath := flag.String("config", "./config.toml", "Config file path (default: ./config.toml)")
+	flag.BoolVar(&migrateDryRun, "migrate-dry-run", false, "Report how many records each pending DB migration would touch, then exit")
+	flag.StringVar(&archiveKeyFile, "archive-key-file", "", "File of the base64-encoded 32-byte key for encrypting/decrypting backup archives")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [backup [file] | restore [file]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	config = LoadConfig(*configPath)
 }
@@ -35,6 +45,7 @@ func cleanup() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if srv != nil {
+		cancelSrvCtx() // abort the in-flight FIB API requests of HTTP handlers, instead of waiting for them
 		if err := srv.Shutdown(ctx); err != nil {
 			log.Errorf("failed to shutdown HTTP server: %v", err)
 		}
@@ -48,10 +59,21 @@ func cleanup() {
 func main() {
 	defer cleanup()
 	fibapi.Init(config.FIBAPI)
-	db.Init(config.Redis)
+	db.Init(config.Store, config.Redis)
+	if migrateDryRun {
+		if err := db.Migrate(true); err != nil {
+			log.Errorf("failed to dry-run DB migrations: %v", err)
+		}
+		return
+	}
+	if err := db.Migrate(false); err != nil {
+		log.Fatalf("Failed to migrate DB: %v", err)
+	}
+	if runCommand(flag.Arg(0), flag.Args()[min(flag.NArg(), 1):]) {
+		return
+	}
 	bot.Init(config.TelegramBot)
-	job.CacheSubjectCodes()
-	job.Init(config.JobsConfig)
+	job.Init(config.JobsConfig) // if this instance is the leader, it also catches up on caching subject codes and scheduling class reminders
 
 	shutdown := make(chan struct{})
 	go func() { // graceful shutdown
@@ -71,6 +93,9 @@ func main() {
 	if config.MailtoLinkRedirectPath != "" { // mailto link redirect
 		r.HandleFunc(config.MailtoLinkRedirectPath, internal.HandleMailtoLinkRedirect)
 	}
+	if config.CalendarFeedPath != "" { // iCalendar feed of users' class schedules
+		r.HandleFunc(config.CalendarFeedPath, internal.HandleCalendarFeed)
+	}
 
 	srv = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", config.Host, config.Port),
@@ -78,6 +103,7 @@ func main() {
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return srvCtx },
 	}
 	if log.GetLevel() >= log.DebugLevel {
 		srv.ReadTimeout = 1 * time.Minute
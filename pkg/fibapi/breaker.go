@@ -0,0 +1,176 @@
+package fibapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned by requests made while the circuit breaker is open, i.e., FIB API is considered down
+var ErrCircuitOpen = errors.New("fibapi: circuit breaker is open, FIB API is unavailable")
+
+// BreakerState represents a state of the circuit breaker of requests to FIB API
+type BreakerState int
+
+// circuit breaker states
+const (
+	BreakerClosed   BreakerState = iota // requests are made as usual
+	BreakerOpen                         // requests fail right away with ErrCircuitOpen
+	BreakerHalfOpen                     // a single probing request is made, whose result closes or re-opens the breaker
+)
+
+// String implements the fmt.Stringer interface
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerStatus represents a status of the circuit breaker
+type BreakerStatus struct {
+	State     BreakerState
+	Since     time.Time // when it got closed, or when it got opened for the current outage if not closed
+	Failures  int       // consecutive failed requests
+	LastError error     // of the last failed request, nil if closed
+}
+
+// circuitBreaker is a circuit breaker of requests to FIB API, it opens after `threshold` consecutive transient failures,
+// and after `cooldown` lets a single request through to probe whether FIB API has recovered
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	status    BreakerStatus
+	openedAt  time.Time // when it got (re-)opened, which may be later than `status.Since`
+	probing   bool      // whether the probing request of half-open state is in flight
+	onChange  func(from, to BreakerStatus)
+}
+
+// breaker is the circuit breaker shared by the private and public API clients
+var breaker = newCircuitBreaker(defaultBreakerThreshold, defaultBreakerCooldown)
+
+// newCircuitBreaker initializes a closed circuit breaker with the given threshold and cooldown
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		status:    BreakerStatus{State: BreakerClosed, Since: time.Now()},
+	}
+}
+
+// GetBreakerStatus gets the current status of the circuit breaker of requests to FIB API
+func GetBreakerStatus() BreakerStatus {
+	return breaker.getStatus()
+}
+
+// OnBreakerStateChange sets the function to be called with the previous and the new status on each state change
+// of the circuit breaker, it's called synchronously by the request causing the change
+func OnBreakerStateChange(fn func(from, to BreakerStatus)) {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	breaker.onChange = fn
+}
+
+// getStatus returns the current status, which is half-open if it's open but the cooldown has passed
+func (cb *circuitBreaker) getStatus() BreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	status := cb.status
+	if status.State == BreakerOpen && time.Since(cb.openedAt) >= cb.cooldown {
+		status.State = BreakerHalfOpen
+	}
+	return status
+}
+
+// wrap wraps the given request function so it's made through the circuit breaker
+func (cb *circuitBreaker) wrap(request func(context.Context) ([]byte, http.Header, error)) func(context.Context) ([]byte, http.Header, error) {
+	return func(ctx context.Context) ([]byte, http.Header, error) {
+		if err := cb.allow(); err != nil {
+			return nil, nil, err
+		}
+		body, header, err := request(ctx)
+		cb.record(ctx, err)
+		return body, header, err
+	}
+}
+
+// allow returns ErrCircuitOpen if a request can't be made now
+func (cb *circuitBreaker) allow() error {
+	cb.mu.Lock()
+	switch cb.status.State {
+	case BreakerOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			cb.mu.Unlock()
+			return ErrCircuitOpen
+		}
+		from := cb.status
+		cb.status.State = BreakerHalfOpen
+		cb.probing = true
+		cb.unlockAndNotify(from)
+		return nil
+	case BreakerHalfOpen:
+		if cb.probing {
+			cb.mu.Unlock()
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+	}
+	cb.mu.Unlock()
+	return nil
+}
+
+// record records the result of a request made with the given context
+// transient failures count towards opening the breaker, while other errors mean FIB API is up
+func (cb *circuitBreaker) record(ctx context.Context, err error) {
+	cb.mu.Lock()
+	from := cb.status
+	if cb.status.State == BreakerHalfOpen {
+		cb.probing = false
+	}
+	switch {
+	case err != nil && ctx.Err() != nil: // cancelled by the caller, tells nothing about FIB API
+		cb.mu.Unlock()
+		return
+	case err != nil && isTransientError(err):
+		cb.status.Failures++
+		cb.status.LastError = err
+		if cb.status.State == BreakerHalfOpen || cb.status.Failures >= cb.threshold {
+			if cb.status.State == BreakerClosed {
+				cb.status.Since = time.Now()
+			}
+			cb.status.State = BreakerOpen
+			cb.openedAt = time.Now()
+		}
+	default:
+		if cb.status.State != BreakerClosed {
+			cb.status.Since = time.Now()
+		}
+		cb.status.State = BreakerClosed
+		cb.status.Failures = 0
+		cb.status.LastError = nil
+	}
+	cb.unlockAndNotify(from)
+}
+
+// unlockAndNotify unlocks the breaker, and calls the state change function if the state has changed from the given status
+func (cb *circuitBreaker) unlockAndNotify(from BreakerStatus) {
+	to, onChange := cb.status, cb.onChange
+	cb.mu.Unlock()
+	if to.State != from.State && onChange != nil {
+		onChange(from, to)
+	}
+}
@@ -0,0 +1,64 @@
+package fibapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	cb := newCircuitBreaker(2, 20*time.Millisecond)
+	var changes []BreakerState
+	cb.onChange = func(from, to BreakerStatus) { changes = append(changes, to.State) }
+
+	unavailable := &APIError{StatusCode: http.StatusBadGateway}
+	var result error
+	request := cb.wrap(func(context.Context) ([]byte, http.Header, error) { return nil, nil, result })
+	call := func(err error) error {
+		result = err
+		_, _, err = request(context.Background())
+		return err
+	}
+
+	// non-transient errors mean FIB API is up, resetting the failures
+	for _, err := range []error{unavailable, ErrResourceNotFound, unavailable} {
+		_ = call(err)
+	}
+	if s := cb.getStatus(); s.State != BreakerClosed || s.Failures != 1 {
+		t.Fatalf("got status %+v, want closed with 1 failure", s)
+	}
+
+	// opens after consecutive failures
+	_ = call(unavailable)
+	if s := cb.getStatus(); s.State != BreakerOpen || s.LastError != unavailable {
+		t.Fatalf("got status %+v, want open", s)
+	}
+	if err := call(nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("request while open: got %v", err)
+	}
+
+	// a failed probe re-opens it, and a successful one closes it
+	time.Sleep(20 * time.Millisecond)
+	if s := cb.getStatus(); s.State != BreakerHalfOpen {
+		t.Errorf("after cooldown: got state %s", s.State)
+	}
+	_ = call(context.DeadlineExceeded)
+	if err := call(nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("request after a failed probe: got %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := call(nil); err != nil {
+		t.Errorf("probe: got %v", err)
+	}
+	if s := cb.getStatus(); s.State != BreakerClosed || s.Failures != 0 || s.LastError != nil {
+		t.Errorf("got status %+v, want closed", s)
+	}
+
+	want := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if !slices.Equal(changes, want) {
+		t.Errorf("got state changes %v, want %v", changes, want)
+	}
+}
@@ -22,8 +22,10 @@ const (
 	userInfoURL              = "https://api.fib.upc.edu/v2/jo.json"
 	noticesURL               = "https://api.fib.upc.edu/v2/jo/avisos.json"
 	subjectsURL              = "https://api.fib.upc.edu/v2/jo/assignatures.json"
+	scheduleURL              = "https://api.fib.upc.edu/v2/jo/classes.json"
 	publicSubjectsURL        = "https://api.fib.upc.edu/v2/assignatures.json"
 	publicSubjectURLTemplate = "https://api.fib.upc.edu/v2/assignatures/%s.json"
+	publicExamsURL           = "https://api.fib.upc.edu/v2/examens.json"
 	loginRedirectBaseURL     = "https://api.fib.upc.edu/v2/accounts/login/?next="
 )
 
@@ -39,6 +41,8 @@ const (
 	tlsHandshakeTimeout = 5 * time.Second
 	httpClientTimeout   = 20 * time.Second
 	requestTimeout      = 10 * time.Second
+
+	defaultMaxIdleConnsPerHost = 8
 )
 
 // errors
@@ -47,4 +51,5 @@ var (
 	ErrAuthorizationExpired     = errors.New("fibapi: authorization has expired")
 	ErrNoticeNotFound           = errors.New("fibapi: notice not found")
 	ErrResourceNotFound         = errors.New("fibapi: resource not found")
+	ErrNotModified              = errors.New("fibapi: not modified")
 )
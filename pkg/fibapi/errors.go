@@ -0,0 +1,83 @@
+package fibapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError represents an error response (i.e., with a non-200 HTTP status) from the FIB API,
+// it matches ErrAuthorizationExpired and ErrResourceNotFound with errors.Is when it means so
+type APIError struct {
+	StatusCode int
+	Detail     string        // `detail` in the response body, if any
+	ErrorCode  string        // `error` in the response body (e.g., `invalid_grant` from OAuth), if any
+	URL        string        // URL of the request
+	RetryAfter time.Duration // from the `Retry-After` response header, 0 if absent
+	body       []byte
+}
+
+// newAPIError makes an APIError from the given response to the request to the given URL, with its body already read
+func newAPIError(URL string, resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		URL:        URL,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		body:       body,
+	}
+	var r Response
+	if json.Unmarshal(body, &r) == nil {
+		e.Detail = r.Detail
+		e.ErrorCode = r.Error
+	}
+	return e
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.ErrorCode
+	}
+	if msg == "" {
+		msg = strings.TrimSpace(string(e.body))
+	}
+	return fmt.Sprintf("fibapi: bad response (HTTP %d) from %s: %s", e.StatusCode, e.URL, msg)
+}
+
+// Unwrap returns the sentinel error the response means, if any, so the error can be checked with errors.Is
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrAuthorizationExpired // token has expired or has been revoked on server
+	case e.StatusCode == http.StatusBadRequest && e.ErrorCode == oauthInvalidAuthorizationCodeResponseErrorMessage:
+		return ErrAuthorizationExpired // refresh token has expired or has been revoked on server
+	case e.StatusCode == http.StatusNotFound && e.Detail == resourceNotFoundResponseDetail:
+		return ErrResourceNotFound
+	}
+	return nil
+}
+
+// Temporary returns whether the error is likely transient (i.e., server is overloaded or down),
+// so the request may succeed if retried later (after RetryAfter if it's given)
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// parseRetryAfter parses the given value of a `Retry-After` header, which is either seconds or an HTTP date,
+// into the duration to wait from the given time, 0 if it's empty or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package fibapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		status    int
+		header    string
+		body      string
+		expired   bool
+		notFound  bool
+		temporary bool
+	}{
+		{http.StatusUnauthorized, "", `{"detail":"Invalid token."}`, true, false, false},
+		{http.StatusBadRequest, "", `{"error":"invalid_grant"}`, true, false, false},
+		{http.StatusBadRequest, "", `{"error":"invalid_client"}`, false, false, false},
+		{http.StatusNotFound, "", `{"detail":"Not found."}`, false, true, false},
+		{http.StatusTooManyRequests, "30", ``, false, false, true},
+		{http.StatusServiceUnavailable, "", `<html>`, false, false, true},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("Retry-After", tt.header)
+		}
+		err := fmt.Errorf("wrapped: %w", newAPIError(noticesURL, resp, []byte(tt.body)))
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+			t.Errorf("HTTP %d: errors.As got %v", tt.status, apiErr)
+			continue
+		}
+		if got := errors.Is(err, ErrAuthorizationExpired); got != tt.expired {
+			t.Errorf("HTTP %d %s: is ErrAuthorizationExpired: got %t", tt.status, tt.body, got)
+		}
+		if got := errors.Is(err, ErrResourceNotFound); got != tt.notFound {
+			t.Errorf("HTTP %d %s: is ErrResourceNotFound: got %t", tt.status, tt.body, got)
+		}
+		if got := apiErr.Temporary(); got != tt.temporary {
+			t.Errorf("HTTP %d: temporary: got %t", tt.status, got)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-5":                            0,
+		"Fri, 01 Mar 2024 12:00:30 GMT": 30 * time.Second,
+		"Fri, 01 Mar 2024 11:00:00 GMT": 0,
+		"soon":                          0,
+	}
+	for value, want := range tests {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q): got %s, want %s", value, got, want)
+		}
+	}
+}
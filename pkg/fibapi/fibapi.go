@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"golang.org/x/oauth2"
 )
@@ -32,6 +33,20 @@ type Config struct {
 	OAuthRedirectURI  string `toml:"oauth_redirect_uri"`
 	PublicClientID    string `toml:"public_client_id"`
 	ClientUserAgent   string `toml:"client_user_agent,omitempty"`
+
+	// limits of requests to FIB API server (by all clients), no limit if RequestsPerSecond is 0
+	RequestsPerSecond float64 `toml:"requests_per_second,omitempty"`
+	RequestBurst      int     `toml:"request_burst,omitempty"`
+	// max idle (keep-alive) connections kept to FIB API server, should be at least the number of concurrent requests
+	MaxIdleConnsPerHost int `toml:"max_idle_conns_per_host,omitempty"`
+	// retries of GET requests on transient failures (429, 5xx, timeouts and connection resets), no retry if MaxRetries is 0
+	MaxRetries     int    `toml:"max_retries,omitempty"`
+	RetryBaseDelay string `toml:"retry_base_delay,omitempty"` // backoff before the first retry, doubled for each next one, e.g., `500ms`
+	RetryMaxDelay  string `toml:"retry_max_delay,omitempty"`  // e.g., `8s`
+	RetryBudget    string `toml:"retry_budget,omitempty"`     // max total time of a request including its retries, e.g., `30s`
+	// circuit breaker, which opens after BreakerThreshold consecutive transient failures, and probes after BreakerCooldown
+	BreakerThreshold int    `toml:"breaker_threshold,omitempty"`
+	BreakerCooldown  string `toml:"breaker_cooldown,omitempty"` // e.g., `30s`
 }
 
 // Init initializes the FIB API clients
@@ -44,6 +59,11 @@ func Init(config Config) {
 		baseReqHeader.Set("User-Agent", config.ClientUserAgent)
 	}
 
+	maxIdleConnsPerHost := config.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+
 	// private API OAuth config
 	oauthConf = &oauth2.Config{
 		ClientID:     config.OAuthClientID,
@@ -68,6 +88,7 @@ func Init(config Config) {
 			},
 			TLSHandshakeTimeout: tlsHandshakeTimeout,
 			ForceAttemptHTTP2:   false,
+			MaxIdleConnsPerHost: maxIdleConnsPerHost,
 		},
 		Timeout: httpClientTimeout,
 	}
@@ -83,9 +104,28 @@ func Init(config Config) {
 			},
 			TLSHandshakeTimeout: tlsHandshakeTimeout,
 			ForceAttemptHTTP2:   false,
+			MaxIdleConnsPerHost: maxIdleConnsPerHost,
 		},
 		Timeout: httpClientTimeout,
 	}
+
+	if retries, err = newRetryPolicy(config); err != nil {
+		panic(err)
+	}
+	if config.BreakerThreshold > 0 {
+		breaker.threshold = config.BreakerThreshold
+	}
+	if config.BreakerCooldown != "" {
+		if breaker.cooldown, err = time.ParseDuration(config.BreakerCooldown); err != nil || breaker.cooldown <= 0 {
+			panic(fmt.Errorf("fibapi: invalid breaker cooldown %q", config.BreakerCooldown))
+		}
+	}
+
+	if config.RequestsPerSecond > 0 {
+		bucket := newTokenBucket(config.RequestsPerSecond, config.RequestBurst)
+		privateClient.Transport = &rateLimitedTransport{privateClient.Transport, bucket}
+		publicClient.Transport = &rateLimitedTransport{publicClient.Transport, bucket}
+	}
 }
 
 // NewAuthorizationURL generates an authorization URL with the given state
@@ -95,16 +135,21 @@ func NewAuthorizationURL(state string) string {
 
 // Authorize tries to retrieve OAuth token with the given Authorization Code
 func Authorize(authorizationCode string) (*oauth2.Token, UserInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	return AuthorizeContext(context.Background(), authorizationCode)
+}
+
+// AuthorizeContext is like Authorize but with the given context
+func AuthorizeContext(ctx context.Context, authorizationCode string) (*oauth2.Token, UserInfo, error) {
+	exchangeCtx, cancel := context.WithTimeout(ctx, requestTimeout)
 	defer cancel()
 
-	token, err := oauthConf.Exchange(ctx, authorizationCode)
+	token, err := oauthConf.Exchange(exchangeCtx, authorizationCode)
 	if err != nil {
 		return nil, UserInfo{}, ProcessTokenError(err)
 	}
 
 	// try to get UserInfo and check if the retrieved token is really valid
-	userInfo, err := NewClientFromToken(token).GetUserInfo()
+	userInfo, err := NewClientFromTokenContext(ctx, token).GetUserInfoContext(ctx)
 	if err != nil {
 		return nil, UserInfo{}, fmt.Errorf("fibapi: error getting user info: %w", err)
 	}
@@ -2,6 +2,8 @@ package fibapi
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
@@ -93,6 +95,33 @@ type Class struct {
 	Classrooms  string `json:"aules"`
 }
 
+const classStartTimeLayout = "15:04"
+
+// Weekday returns the day of week of the Class
+// FIB API numbers the days from 1 (Monday) to 7 (Sunday)
+func (c Class) Weekday() time.Weekday {
+	return time.Weekday(c.DayOfWeek % 7)
+}
+
+// Start returns the start time&date of the Class on the same day as the given date, in Madrid timezone
+func (c Class) Start(date time.Time) (time.Time, error) {
+	t, err := time.ParseInLocation(classStartTimeLayout, c.StartTime, tzMadrid)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fibapi: error parsing class start time: %w", err)
+	}
+	y, m, d := date.In(tzMadrid).Date()
+	return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, tzMadrid), nil
+}
+
+// End returns the end time&date of the Class on the same day as the given date, in Madrid timezone
+func (c Class) End(date time.Time) (time.Time, error) {
+	start, err := c.Start(date)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return start.Add(time.Duration(c.Duration) * time.Hour), nil
+}
+
 // SubjectsResponse represents a user's subjects API response
 // Endpoint: /jo/assignatures.json
 type SubjectsResponse struct {
@@ -131,8 +160,17 @@ func init() {
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for Time type
-// it un-marshals the `2006-01-02T15:04:05`-format time&date strings to Time type
+// it un-marshals the `2006-01-02T15:04:05`-format time&date strings to Time type,
+// as well as the UNIX timestamps marshalled by MarshalJSON
 func (t *Time) UnmarshalJSON(b []byte) (err error) {
+	if len(b) > 0 && b[0] != '"' {
+		var timestamp int64
+		if timestamp, err = strconv.ParseInt(string(b), 10, 64); err != nil {
+			return err
+		}
+		t.Time = time.Unix(timestamp, 0).In(tzMadrid)
+		return nil
+	}
 	t.Time, err = time.ParseInLocation(timeDateLayout, strings.Trim(string(b), `"`), tzMadrid)
 	return err
 }
@@ -175,3 +213,44 @@ type PublicSubjectsResponse struct {
 	PreviousURL string          `json:"previous,omitempty"`
 	Results     []PublicSubject `json:"results"`
 }
+
+// PublicExamsResponse represents a public exams API response
+// Endpoint: /examens.json
+type PublicExamsResponse struct {
+	Count       uint32 `json:"count"`
+	NextURL     string `json:"next,omitempty"`
+	PreviousURL string `json:"previous,omitempty"`
+	Results     []Exam `json:"results"`
+}
+
+// Exam represents a single exam in a PublicExamsResponse API response
+type Exam struct {
+	ID          int32  `json:"id"`
+	SubjectCode string `json:"assig"`
+	Classrooms  string `json:"aules"`
+	StartsAt    Time   `json:"inici"`
+	EndsAt      Time   `json:"fi"`
+	Semester    uint8  `json:"quatr"`
+	Year        uint16 `json:"curs"`
+	Plan        string `json:"pla"`
+	Type        string `json:"tipus"` // `P` for midterm, `F` for final
+	Comments    string `json:"comentaris"`
+	IsLab       string `json:"eslaboratori"` // `S` for yes, `N` for no
+}
+
+// Validators represents the validators of a response, for making a conditional request which is responded
+// with `304 Not Modified` (without the body) if the response hasn't changed since
+type Validators struct {
+	ETag         string
+	LastModified string
+	Size         int // of the response body, i.e., the bytes saved if it's not modified
+}
+
+// newValidators makes the Validators of a response with the given header and body
+func newValidators(header http.Header, body []byte) Validators {
+	return Validators{
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Size:         len(body),
+	}
+}
@@ -20,29 +20,46 @@ var privateClient *http.Client
 // the token may expire, but the underlying OAuth client will try to refresh it in later API requests
 type PrivateClient struct {
 	*http.Client
-	ctx context.Context
 }
 
 // NewClient initializes a FIB API private client with the given OAuth token
 func NewClient(accessToken string, refreshToken string, expiry int64) *PrivateClient {
+	return NewClientContext(context.Background(), accessToken, refreshToken, expiry)
+}
+
+// NewClientContext is like NewClient but the token is refreshed with the given context,
+// so a refresh is aborted once it's cancelled
+func NewClientContext(ctx context.Context, accessToken string, refreshToken string, expiry int64) *PrivateClient {
 	token := oauth2.Token{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 		Expiry:       time.Unix(expiry, 0),
 		TokenType:    "Bearer",
 	}
-	return NewClientFromToken(&token)
+	return NewClientFromTokenContext(ctx, &token)
 }
 
+// NewClientFromToken initializes a FIB API private client with the given OAuth token
 func NewClientFromToken(token *oauth2.Token) *PrivateClient {
-	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, privateClient)
+	return NewClientFromTokenContext(context.Background(), token)
+}
+
+// NewClientFromTokenContext is like NewClientFromToken but the token is refreshed with the given context,
+// so a refresh is aborted once it's cancelled
+func NewClientFromTokenContext(ctx context.Context, token *oauth2.Token) *PrivateClient {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, privateClient)
 	client := oauth2.NewClient(ctx, oauthConf.TokenSource(ctx, token))
-	return &PrivateClient{client, ctx}
+	return &PrivateClient{client}
 }
 
 // GetUserInfo gets the user's basic information (username, first name and last name only)
 func (c *PrivateClient) GetUserInfo() (UserInfo, error) {
-	body, _, err := c.request(http.MethodGet, userInfoURL)
+	return c.GetUserInfoContext(context.Background())
+}
+
+// GetUserInfoContext is like GetUserInfo but with the given context
+func (c *PrivateClient) GetUserInfoContext(ctx context.Context) (UserInfo, error) {
+	body, _, err := c.request(ctx, http.MethodGet, userInfoURL, Validators{})
 	if err != nil {
 		return UserInfo{}, err
 	}
@@ -56,18 +73,36 @@ func (c *PrivateClient) GetUserInfo() (UserInfo, error) {
 
 // GetNotices gets the user's notices
 func (c *PrivateClient) GetNotices() ([]Notice, error) {
-	return c.GetNoticesSince(0)
+	return c.GetNoticesSinceContext(context.Background(), 0)
+}
+
+// GetNoticesContext is like GetNotices but with the given context
+func (c *PrivateClient) GetNoticesContext(ctx context.Context) ([]Notice, error) {
+	return c.GetNoticesSinceContext(ctx, 0)
 }
 
 // GetNoticesSince gets the user's notices published since the given timestamp
 func (c *PrivateClient) GetNoticesSince(timestamp int64) ([]Notice, error) {
-	body, _, err := c.request(http.MethodGet, noticesURL)
+	return c.GetNoticesSinceContext(context.Background(), timestamp)
+}
+
+// GetNoticesSinceContext is like GetNoticesSince but with the given context
+func (c *PrivateClient) GetNoticesSinceContext(ctx context.Context, timestamp int64) ([]Notice, error) {
+	ns, _, err := c.GetNoticesSinceIfModifiedContext(ctx, timestamp, Validators{})
+	return ns, err
+}
+
+// GetNoticesSinceIfModifiedContext is like GetNoticesSinceContext, but it returns ErrNotModified (without fetching them)
+// if the notices haven't changed since the response with the given validators,
+// along with the validators of the new response for the next call
+func (c *PrivateClient) GetNoticesSinceIfModifiedContext(ctx context.Context, timestamp int64, v Validators) ([]Notice, Validators, error) {
+	body, header, err := c.request(ctx, http.MethodGet, noticesURL, v)
 	if err != nil {
-		return nil, err
+		return nil, v, err
 	}
 	var resp NoticesResponse
 	if err = json.Unmarshal(body, &resp); err != nil {
-		return nil, fmt.Errorf("fibapi: error parsing Notices: %w", err)
+		return nil, v, fmt.Errorf("fibapi: error parsing Notices: %w", err)
 	}
 
 	ns := make([]Notice, 0, len(resp.Results))
@@ -86,12 +121,17 @@ func (c *PrivateClient) GetNoticesSince(timestamp int64) ([]Notice, error) {
 		}
 		return ns[i].PublishedAt.Unix() < ns[j].PublishedAt.Unix()
 	})
-	return ns, nil
+	return ns, newValidators(header, body), nil
 }
 
 // GetNotice gets a specific notice with the given ID
 func (c *PrivateClient) GetNotice(ID int32) (Notice, error) {
-	notices, err := c.GetNotices()
+	return c.GetNoticeContext(context.Background(), ID)
+}
+
+// GetNoticeContext is like GetNotice but with the given context
+func (c *PrivateClient) GetNoticeContext(ctx context.Context, ID int32) (Notice, error) {
+	notices, err := c.GetNoticesContext(ctx)
 	if err != nil {
 		return Notice{}, err
 	}
@@ -106,7 +146,12 @@ func (c *PrivateClient) GetNotice(ID int32) (Notice, error) {
 
 // GetSubjects gets the user's subjects
 func (c *PrivateClient) GetSubjects() ([]Subject, error) {
-	body, _, err := c.request(http.MethodGet, subjectsURL)
+	return c.GetSubjectsContext(context.Background())
+}
+
+// GetSubjectsContext is like GetSubjects but with the given context
+func (c *PrivateClient) GetSubjectsContext(ctx context.Context) ([]Subject, error) {
+	body, _, err := c.request(ctx, http.MethodGet, subjectsURL, Validators{})
 	if err != nil {
 		return nil, err
 	}
@@ -117,32 +162,93 @@ func (c *PrivateClient) GetSubjects() ([]Subject, error) {
 	return resp.Results, nil
 }
 
+// GetSchedule gets the user's weekly class schedule
+func (c *PrivateClient) GetSchedule() ([]Class, error) {
+	return c.GetScheduleContext(context.Background())
+}
+
+// GetScheduleContext is like GetSchedule but with the given context
+func (c *PrivateClient) GetScheduleContext(ctx context.Context) ([]Class, error) {
+	body, _, err := c.request(ctx, http.MethodGet, scheduleURL, Validators{})
+	if err != nil {
+		return nil, err
+	}
+	var resp ScheduleResponse
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("fibapi: error parsing Schedule: %w", err)
+	}
+
+	classes := resp.Results
+	sort.Slice(classes, func(i, j int) bool {
+		// sort orders: DayOfWeek, StartTime, SubjectCode
+		if classes[i].DayOfWeek == classes[j].DayOfWeek {
+			if classes[i].StartTime == classes[j].StartTime {
+				return classes[i].SubjectCode < classes[j].SubjectCode
+			}
+			return classes[i].StartTime < classes[j].StartTime
+		}
+		return classes[i].DayOfWeek < classes[j].DayOfWeek
+	})
+	return classes, nil
+}
+
 // RevokeToken revokes the user's OAuth token
 func (c *PrivateClient) RevokeToken() error {
+	return c.RevokeTokenContext(context.Background())
+}
+
+// RevokeTokenContext is like RevokeToken but with the given context
+func (c *PrivateClient) RevokeTokenContext(ctx context.Context) error {
 	token, err := c.Client.Transport.(*oauth2.Transport).Source.Token()
 	if err != nil {
 		return fmt.Errorf("fibapi: error extracting token: %w", err)
 	}
 
-	if _, err = c.Client.PostForm(oauthRevokeURL, url.Values{
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	form := url.Values{
 		"client_id": {oauthConf.ClientID},
 		"token":     {token.AccessToken},
-	}); err != nil {
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, oauthRevokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("fibapi: error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.Client.Do(req)
+	if err != nil {
 		return fmt.Errorf("fibapi: error revoking token: %w", err)
 	}
+	resp.Body.Close()
 	return nil
 }
 
 // GetAttachmentFile gets the given Attachment's bytes
 // BE CAREFUL: some attachments posted on racó are copyright-protected and should not be stored nor accessed by third-parties
 func (c *PrivateClient) GetAttachmentFile(a Attachment) ([]byte, error) {
-	body, _, err := c.request(http.MethodGet, strings.TrimSuffix(a.URL, `.json`))
+	return c.GetAttachmentFileContext(context.Background(), a)
+}
+
+// GetAttachmentFileContext is like GetAttachmentFile but with the given context
+func (c *PrivateClient) GetAttachmentFileContext(ctx context.Context, a Attachment) ([]byte, error) {
+	body, _, err := c.request(ctx, http.MethodGet, strings.TrimSuffix(a.URL, `.json`), Validators{})
 	return body, err
 }
 
-// request makes a request to Private FIB API using the given HTTP method and URL
-func (c *PrivateClient) request(method, URL string) ([]byte, http.Header, error) {
-	ctx, cancel := context.WithTimeout(c.ctx, requestTimeout)
+// request makes a request to Private FIB API using the given HTTP method and URL, retrying it on transient failures
+// following the retry policy, through the circuit breaker, it's cancelled when the given context is done
+// if any of the given validators (of a previous response) is set, it's a conditional request,
+// which returns ErrNotModified if the response hasn't changed since
+func (c *PrivateClient) request(ctx context.Context, method, URL string, v Validators) ([]byte, http.Header, error) {
+	return retries.do(ctx, method, breaker.wrap(func(ctx context.Context) ([]byte, http.Header, error) {
+		return c.requestOnce(ctx, method, URL, v)
+	}))
+}
+
+// requestOnce makes a single attempt of a request to Private FIB API using the given HTTP method, URL and validators,
+// it's cancelled when the given context is done, or times out after requestTimeout
+func (c *PrivateClient) requestOnce(ctx context.Context, method, URL string, v Validators) ([]byte, http.Header, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, method, URL, nil)
@@ -150,6 +256,16 @@ func (c *PrivateClient) request(method, URL string) ([]byte, http.Header, error)
 		return nil, nil, fmt.Errorf("fibapi: error creating request: %w", err)
 	}
 	req.Header = baseReqHeader.Clone()
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+	conditional := v.ETag != "" || v.LastModified != ""
+	if conditional {
+		conditionalCount.Add(1)
+	}
 
 	var body []byte
 	resp, err := c.Client.Do(req)
@@ -168,14 +284,13 @@ func (c *PrivateClient) request(method, URL string) ([]byte, http.Header, error)
 		}
 	}
 
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		notModifiedCount.Add(1)
+		bytesSavedCount.Add(uint64(v.Size))
+		return nil, resp.Header, ErrNotModified
+	}
 	if resp.StatusCode != http.StatusOK {
-		// API error handling
-		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusBadRequest {
-			// token has expired or has been revoked on server
-			return body, resp.Header, ErrAuthorizationExpired
-		} else {
-			return body, resp.Header, fmt.Errorf("fibapi: bad response (HTTP %d): %s", resp.StatusCode, string(body))
-		}
+		return body, resp.Header, newAPIError(URL, resp, body)
 	}
 
 	return body, resp.Header, nil // return with response header for future error handling
@@ -0,0 +1,81 @@
+package fibapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestPrivateClientConditionalRequest(t *testing.T) {
+	const etag = `"v1"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", "Fri, 01 Mar 2024 12:00:00 GMT")
+		_, _ = w.Write([]byte(`{"count":0,"results":[]}`))
+	}))
+	defer srv.Close()
+	c := &PrivateClient{srv.Client()}
+
+	body, header, err := c.requestOnce(context.Background(), http.MethodGet, srv.URL, Validators{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := newValidators(header, body)
+	if v.ETag != etag || v.LastModified == "" || v.Size != len(body) {
+		t.Fatalf("got validators %+v", v)
+	}
+
+	start := GetStats()
+	if _, _, err = c.requestOnce(context.Background(), http.MethodGet, srv.URL, v); !errors.Is(err, ErrNotModified) {
+		t.Errorf("conditional request: got %v, want ErrNotModified", err)
+	}
+	if _, _, err = c.requestOnce(context.Background(), http.MethodGet, srv.URL, Validators{ETag: `"v0"`}); err != nil {
+		t.Errorf("conditional request with outdated validators: got %v", err)
+	}
+	want := Stats{Conditional: 2, NotModified: 1, BytesSaved: uint64(v.Size)}
+	if stats := GetStats().Sub(start); stats != want {
+		t.Errorf("got stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestPrivateClientTokenRefreshCancelled(t *testing.T) {
+	refreshing, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(refreshing)
+		<-release // the token endpoint hangs
+	}))
+	defer srv.Close()
+	defer close(release)
+	defer func(conf *oauth2.Config, client *http.Client) { oauthConf, privateClient = conf, client }(oauthConf, privateClient)
+	oauthConf = &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: srv.URL, AuthStyle: oauth2.AuthStyleInParams}}
+	privateClient = srv.Client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewClientContext(ctx, "access", "refresh", time.Now().Add(-time.Hour).Unix()) // expired
+	go func() {
+		<-refreshing
+		cancel()
+	}()
+	done := make(chan error)
+	go func() {
+		_, err := c.Transport.(*oauth2.Transport).Source.Token()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want the refresh cancelled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("token refresh not aborted when its context is cancelled")
+	}
+}
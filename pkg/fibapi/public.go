@@ -16,6 +16,11 @@ var (
 
 // GetPublicSubjects gets all subjects from the public API
 func GetPublicSubjects() ([]PublicSubject, error) {
+	return GetPublicSubjectsContext(context.Background())
+}
+
+// GetPublicSubjectsContext is like GetPublicSubjects but with the given context
+func GetPublicSubjectsContext(ctx context.Context) ([]PublicSubject, error) {
 	timeout := httpClientTimeout * 3
 
 	var saidTotal uint32
@@ -28,7 +33,7 @@ func GetPublicSubjects() ([]PublicSubject, error) {
 			return nil, fmt.Errorf("fibapi: error fetching PublicSubjects: timed out")
 		}
 
-		body, _, err := requestPublic(http.MethodGet, URL)
+		body, _, err := requestPublic(ctx, http.MethodGet, URL)
 		if err != nil {
 			return nil, err
 		}
@@ -58,7 +63,12 @@ func GetPublicSubjects() ([]PublicSubject, error) {
 
 // GetPublicSubject gets a subject with the given acronym from the public API
 func GetPublicSubject(acronym string) (PublicSubject, error) {
-	body, _, err := requestPublic(http.MethodGet, fmt.Sprintf(publicSubjectURLTemplate, acronym))
+	return GetPublicSubjectContext(context.Background(), acronym)
+}
+
+// GetPublicSubjectContext is like GetPublicSubject but with the given context
+func GetPublicSubjectContext(ctx context.Context, acronym string) (PublicSubject, error) {
+	body, _, err := requestPublic(ctx, http.MethodGet, fmt.Sprintf(publicSubjectURLTemplate, acronym))
 	if err != nil {
 		return PublicSubject{}, err
 	}
@@ -70,9 +80,65 @@ func GetPublicSubject(acronym string) (PublicSubject, error) {
 	return subject, nil
 }
 
-// requestPublic makes a request to Public FIB API using the given HTTP method and URL
-func requestPublic(method, URL string) ([]byte, http.Header, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+// GetPublicExams gets all exams from the public API
+func GetPublicExams() ([]Exam, error) {
+	return GetPublicExamsContext(context.Background())
+}
+
+// GetPublicExamsContext is like GetPublicExams but with the given context
+func GetPublicExamsContext(ctx context.Context) ([]Exam, error) {
+	timeout := httpClientTimeout * 3
+
+	var saidTotal uint32
+	var exams []Exam
+
+	URL := publicExamsURL
+	start := time.Now()
+	for { // loop until all pages are fetched
+		if time.Since(start) > timeout {
+			return nil, fmt.Errorf("fibapi: error fetching PublicExams: timed out")
+		}
+
+		body, _, err := requestPublic(ctx, http.MethodGet, URL)
+		if err != nil {
+			return nil, err
+		}
+		var resp PublicExamsResponse
+		if err = json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("fibapi: error parsing PublicExams: %w", err)
+		}
+
+		if saidTotal == 0 {
+			saidTotal = resp.Count
+			exams = make([]Exam, 0, saidTotal)
+		} else if resp.Count != saidTotal {
+			return nil, fmt.Errorf("fibapi: error fetching PublicExams: said total changed during fetching")
+		}
+		exams = append(exams, resp.Results...)
+
+		if resp.NextURL == "" { // all fetched
+			break
+		}
+		URL = resp.NextURL // continue to fetch the next page
+	}
+	if uint32(len(exams)) != saidTotal {
+		return nil, fmt.Errorf("fibapi: error fetching PublicExams: said total %d, got %d", saidTotal, len(exams))
+	}
+	return exams, nil
+}
+
+// requestPublic makes a request to Public FIB API using the given HTTP method and URL, retrying it on transient failures
+// following the retry policy, through the circuit breaker, it's cancelled when the given context is done
+func requestPublic(ctx context.Context, method, URL string) ([]byte, http.Header, error) {
+	return retries.do(ctx, method, breaker.wrap(func(ctx context.Context) ([]byte, http.Header, error) {
+		return requestPublicOnce(ctx, method, URL)
+	}))
+}
+
+// requestPublicOnce makes a single attempt of a request to Public FIB API using the given HTTP method and URL,
+// it's cancelled when the given context is done, or times out after requestTimeout
+func requestPublicOnce(ctx context.Context, method, URL string) ([]byte, http.Header, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, method, URL, nil)
@@ -94,26 +160,7 @@ func requestPublic(method, URL string) ([]byte, http.Header, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		// API error handling
-		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusBadRequest {
-			// token has expired or has been revoked on server
-			return body, resp.Header, ErrAuthorizationExpired
-		} else if resp.StatusCode == http.StatusNotFound {
-			var r Response
-			if err = json.Unmarshal(body, &r); err != nil {
-				return body, resp.Header, fmt.Errorf("fibapi: error parsing response: %w", err)
-			}
-			if r.Detail == resourceNotFoundResponseDetail {
-				return body, resp.Header, ErrResourceNotFound
-			} else {
-				if r.Detail == "" {
-					r.Detail = "(no detail message)"
-				}
-				return body, resp.Header, fmt.Errorf("fibapi: error in response: %s", r.Detail)
-			}
-		} else {
-			return body, resp.Header, fmt.Errorf("fibapi: bad response (HTTP %d): %s", resp.StatusCode, string(body))
-		}
+		return body, resp.Header, newAPIError(URL, resp, body)
 	}
 
 	return body, resp.Header, nil
@@ -0,0 +1,65 @@
+package fibapi
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a token bucket rate limiter, refilled at `rate` tokens per second up to `burst` tokens
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket initializes a full token bucket with the given rate (per second) and burst
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token from the bucket, and returns how long to wait before it can be used
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens-- // may go negative, which is the debt paid by the waiting
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// rateLimitedTransport is an http.RoundTripper which limits the rate of requests made through it with a token bucket,
+// shared by the private and public API clients, so FIB API server is not overwhelmed as a whole
+type rateLimitedTransport struct {
+	base   http.RoundTripper
+	bucket *tokenBucket
+}
+
+// RoundTrip implements the http.RoundTripper interface, waiting for a token before making the request
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if wait := t.bucket.reserve(); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,135 @@
+package fibapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 8 * time.Second
+	defaultRetryBudget    = 30 * time.Second
+)
+
+// retryPolicy represents a policy of retrying idempotent requests on transient failures,
+// with jittered exponential backoff starting from `baseDelay` up to `maxDelay`,
+// within a budget of total time spent on a request (including all its attempts)
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	budget     time.Duration
+}
+
+// retries is the retry policy of requests to FIB API, no retry if `maxRetries` is 0
+var retries retryPolicy
+
+// newRetryPolicy makes a retry policy with the given configuration, using the defaults for unset durations
+func newRetryPolicy(config Config) (retryPolicy, error) {
+	p := retryPolicy{
+		maxRetries: config.MaxRetries,
+		baseDelay:  defaultRetryBaseDelay,
+		maxDelay:   defaultRetryMaxDelay,
+		budget:     defaultRetryBudget,
+	}
+	for _, d := range []struct {
+		value string
+		dst   *time.Duration
+	}{
+		{config.RetryBaseDelay, &p.baseDelay},
+		{config.RetryMaxDelay, &p.maxDelay},
+		{config.RetryBudget, &p.budget},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v <= 0 {
+			return retryPolicy{}, errors.New("fibapi: invalid retry duration " + d.value)
+		}
+		*d.dst = v
+	}
+	return p, nil
+}
+
+// delay returns how long to wait before the retry after the given number of failed attempts,
+// which is a random duration between the half and the whole of the exponential backoff, but not shorter than
+// the given `Retry-After` of the last response
+func (p retryPolicy) delay(attempts int, retryAfter time.Duration) time.Duration {
+	backoff := p.maxDelay
+	if attempts <= 30 { // avoid overflow
+		backoff = min(p.baseDelay<<(attempts-1), p.maxDelay)
+	}
+	backoff = backoff/2 + rand.N(backoff/2+1)
+	return max(backoff, retryAfter)
+}
+
+// do makes a request with the given method using the given function, retrying it on transient failures
+// if the method is idempotent (i.e., GET), until it succeeds, the retries are used up or the budget runs out
+func (p retryPolicy) do(ctx context.Context, method string, request func(context.Context) ([]byte, http.Header, error)) ([]byte, http.Header, error) {
+	if p.maxRetries <= 0 || method != http.MethodGet {
+		return request(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.budget)
+	defer cancel()
+
+	for attempts := 1; ; attempts++ {
+		body, header, err := request(ctx)
+		if err == nil {
+			if attempts > 1 {
+				recoveredCount.Add(1)
+			}
+			return body, header, nil
+		}
+		if ctx.Err() != nil || !isTransientError(err) {
+			if attempts > 1 {
+				exhaustedCount.Add(1)
+			}
+			return body, header, err
+		}
+
+		var retryAfter time.Duration
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			retryAfter = apiErr.RetryAfter
+		}
+		delay := p.delay(attempts, retryAfter)
+		deadline, _ := ctx.Deadline()
+		if attempts > p.maxRetries || time.Now().Add(delay).After(deadline) {
+			exhaustedCount.Add(1)
+			return body, header, err
+		}
+
+		retriedCount.Add(1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			exhaustedCount.Add(1)
+			return body, header, err
+		case <-timer.C:
+		}
+	}
+}
+
+// isTransientError returns whether the given error of a request is likely transient, i.e.,
+// a 429 or 5xx response, a timeout, or a connection reset
+func isTransientError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) || // the attempt timed out
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) // connection closed by server
+}
@@ -0,0 +1,67 @@
+package fibapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := retryPolicy{maxRetries: 5, baseDelay: 100 * time.Millisecond, maxDelay: time.Second, budget: time.Minute}
+	for attempts, want := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second, 100: time.Second} {
+		for i := 0; i < 100; i++ {
+			if got := p.delay(attempts, 0); got < want/2 || got > want {
+				t.Fatalf("delay after %d attempts: got %s, want between %s and %s", attempts, got, want/2, want)
+			}
+		}
+	}
+	if got := p.delay(1, 5*time.Second); got != 5*time.Second {
+		t.Errorf("delay with Retry-After: got %s", got)
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := retryPolicy{maxRetries: 2, baseDelay: time.Millisecond, maxDelay: time.Millisecond, budget: time.Second}
+	unavailable := &APIError{StatusCode: http.StatusServiceUnavailable}
+	tooManyRequests := &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute}
+
+	tests := []struct {
+		name     string
+		method   string
+		errs     []error // returned by each attempt, then nil
+		attempts int
+		err      error
+		stats    Stats
+	}{
+		{"succeeded", http.MethodGet, nil, 1, nil, Stats{}},
+		{"recovered", http.MethodGet, []error{unavailable, context.DeadlineExceeded}, 3, nil, Stats{Retries: 2, Recovered: 1}},
+		{"exhausted", http.MethodGet, []error{unavailable, unavailable, unavailable}, 3, unavailable, Stats{Retries: 2, Exhausted: 1}},
+		{"not transient", http.MethodGet, []error{ErrAuthorizationExpired}, 1, ErrAuthorizationExpired, Stats{}},
+		{"not idempotent", http.MethodPost, []error{unavailable}, 1, unavailable, Stats{}},
+		{"Retry-After beyond budget", http.MethodGet, []error{tooManyRequests}, 1, tooManyRequests, Stats{Exhausted: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := GetStats()
+			attempts := 0
+			_, _, err := p.do(context.Background(), tt.method, func(context.Context) ([]byte, http.Header, error) {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return nil, nil, tt.errs[attempts-1]
+				}
+				return nil, nil, nil
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("got %d attempts, want %d", attempts, tt.attempts)
+			}
+			if stats := GetStats().Sub(start); stats != tt.stats {
+				t.Errorf("got stats %+v, want %+v", stats, tt.stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package fibapi
+
+import "sync/atomic"
+
+// counters of requests to FIB API, see Stats
+var (
+	retriedCount, recoveredCount, exhaustedCount atomic.Uint64
+	conditionalCount, notModifiedCount           atomic.Uint64
+	bytesSavedCount                              atomic.Uint64
+)
+
+// Stats represents the counters of requests to FIB API since the start
+type Stats struct {
+	Retries     uint64 // retries made
+	Recovered   uint64 // requests succeeded after retrying
+	Exhausted   uint64 // requests failed even after retrying, or given up retrying due to the budget
+	Conditional uint64 // conditional requests made, i.e., with validators of a previous response
+	NotModified uint64 // conditional requests responded with `304 Not Modified`
+	BytesSaved  uint64 // response body bytes not downloaded thanks to `304 Not Modified` responses
+}
+
+// GetStats gets the current counters of requests to FIB API
+func GetStats() Stats {
+	return Stats{
+		Retries:     retriedCount.Load(),
+		Recovered:   recoveredCount.Load(),
+		Exhausted:   exhaustedCount.Load(),
+		Conditional: conditionalCount.Load(),
+		NotModified: notModifiedCount.Load(),
+		BytesSaved:  bytesSavedCount.Load(),
+	}
+}
+
+// Sub returns the increase of the counters since the given earlier ones
+func (s Stats) Sub(earlier Stats) Stats {
+	return Stats{
+		Retries:     s.Retries - earlier.Retries,
+		Recovered:   s.Recovered - earlier.Recovered,
+		Exhausted:   s.Exhausted - earlier.Exhausted,
+		Conditional: s.Conditional - earlier.Conditional,
+		NotModified: s.NotModified - earlier.NotModified,
+		BytesSaved:  s.BytesSaved - earlier.BytesSaved,
+	}
+}